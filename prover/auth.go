@@ -1,16 +1,261 @@
 package main
 
 import (
+	"crypto/sha256"
 	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates API keys
+// identityContextKey is the gin context key authMiddleware stores the
+// caller's identity under, so downstream middleware (rateLimitMiddleware)
+// and handlers can key off it instead of the client IP.
+const identityContextKey = "auth_identity"
+
+// clientCAPool holds the *x509.CertPool used to verify mTLS client
+// certificates. It's an atomic.Value so /reload-ca can swap it without a
+// lock shared with the request path.
+var clientCAPool atomic.Value // holds *x509.CertPool
+
+// loadClientCAPool reads a PEM bundle from path and returns the CertPool it
+// builds.
+func loadClientCAPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no valid certificates found in client CA bundle %q", path)
+	}
+
+	return pool, nil
+}
+
+// mtlsEnabled reports whether the server was configured for mutual TLS via
+// CLIENT_CA_BUNDLE.
+func mtlsEnabled() bool {
+	return os.Getenv("CLIENT_CA_BUNDLE") != ""
+}
+
+// ouAllowlist parses CLIENT_CA_OU_ALLOWLIST (comma-separated). An empty
+// allowlist means this dimension isn't checked.
+func ouAllowlist() []string {
+	return parseAllowlistEnv("CLIENT_CA_OU_ALLOWLIST")
+}
+
+// cnAllowlist parses CLIENT_CA_CN_ALLOWLIST (comma-separated). An empty
+// allowlist means this dimension isn't checked.
+func cnAllowlist() []string {
+	return parseAllowlistEnv("CLIENT_CA_CN_ALLOWLIST")
+}
+
+// uriSANAllowlist parses CLIENT_CA_URI_SAN_ALLOWLIST (comma-separated). An
+// empty allowlist means this dimension isn't checked.
+func uriSANAllowlist() []string {
+	return parseAllowlistEnv("CLIENT_CA_URI_SAN_ALLOWLIST")
+}
+
+// parseAllowlistEnv splits a comma-separated env var into its trimmed,
+// non-empty values. Returns nil if the variable is unset or empty.
+func parseAllowlistEnv(name string) []string {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return nil
+	}
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// containsAny reports whether any of values appears in allowlist.
+func containsAny(values, allowlist []string) bool {
+	for _, v := range values {
+		for _, allowed := range allowlist {
+			if v == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// certFingerprint returns the hex SHA-256 fingerprint of cert's raw DER, the
+// conventional client identity for mTLS-authenticated rate limiting and
+// logging.
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyClientCert checks cert's CN, OU, and URI SANs against the
+// configured CLIENT_CA_CN_ALLOWLIST / CLIENT_CA_OU_ALLOWLIST /
+// CLIENT_CA_URI_SAN_ALLOWLIST. Each dimension is only enforced if its
+// allowlist is non-empty, so operators can lock down by whichever
+// identifiers their CA actually populates; configuring none of them means
+// any certificate the CA signed is accepted. Chain verification against
+// clientCAPool already happened in Go's TLS handshake
+// (tls.Config.ClientAuth = RequireAndVerifyClientCert); this only applies
+// the application-level allowlists on top of that.
+func verifyClientCert(cert *x509.Certificate) error {
+	if allowlist := cnAllowlist(); len(allowlist) > 0 {
+		if !containsAny([]string{cert.Subject.CommonName}, allowlist) {
+			return fmt.Errorf("certificate CN %q not in allowlist", cert.Subject.CommonName)
+		}
+	}
+
+	if allowlist := ouAllowlist(); len(allowlist) > 0 {
+		if !containsAny(cert.Subject.OrganizationalUnit, allowlist) {
+			return fmt.Errorf("certificate OU %v not in allowlist", cert.Subject.OrganizationalUnit)
+		}
+	}
+
+	if allowlist := uriSANAllowlist(); len(allowlist) > 0 {
+		uris := make([]string, len(cert.URIs))
+		for i, u := range cert.URIs {
+			uris[i] = u.String()
+		}
+		if !containsAny(uris, allowlist) {
+			return fmt.Errorf("certificate URI SANs %v not in allowlist", uris)
+		}
+	}
+
+	return nil
+}
+
+// mtlsMiddleware authenticates the caller via its TLS client certificate
+// and stores its fingerprint in the gin context under identityContextKey.
+// It's used in place of the bearer authMiddleware when CLIENT_CA_BUNDLE is
+// configured.
+func mtlsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+			log.WithFields(logrus.Fields{
+				"client_ip": c.ClientIP(),
+				"path":      c.Request.URL.Path,
+			}).Warn("No client certificate presented")
+
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "client certificate required"})
+			c.Abort()
+			return
+		}
+
+		cert := c.Request.TLS.PeerCertificates[0]
+		if err := verifyClientCert(cert); err != nil {
+			log.WithFields(logrus.Fields{
+				"client_ip": c.ClientIP(),
+				"cn":        cert.Subject.CommonName,
+				"error":     err.Error(),
+			}).Warn("Client certificate rejected")
+
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "client certificate not authorized"})
+			c.Abort()
+			return
+		}
+
+		fingerprint := certFingerprint(cert)
+		c.Set(identityContextKey, fingerprint)
+
+		log.WithFields(logrus.Fields{
+			"client_ip":   c.ClientIP(),
+			"cn":          cert.Subject.CommonName,
+			"fingerprint": fingerprint,
+		}).Debug("mTLS authentication successful")
+
+		c.Next()
+	}
+}
+
+// reloadCAHandler re-reads CLIENT_CA_BUNDLE from disk and atomically swaps
+// clientCAPool, so operators can rotate client CAs without restarting the
+// process. The GetConfigForClient hook installed in buildTLSConfig reads
+// clientCAPool on every handshake, so new connections verify against the
+// reloaded pool; connections already established are not re-verified.
+func reloadCAHandler(c *gin.Context) {
+	path := os.Getenv("CLIENT_CA_BUNDLE")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CLIENT_CA_BUNDLE not configured"})
+		return
+	}
+
+	pool, err := loadClientCAPool(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientCAPool.Store(pool)
+
+	log.WithFields(logrus.Fields{
+		"path": path,
+	}).Info("Client CA pool reloaded")
+
+	c.JSON(http.StatusOK, gin.H{"status": "reloaded"})
+}
+
+// buildTLSConfig builds the *tls.Config for the HTTPS listener when
+// TLS_CERT/TLS_KEY are set. If CLIENT_CA_BUNDLE is also set, it requires
+// and verifies client certificates against it (mTLS); the pool is re-read
+// on every handshake via GetConfigForClient so /reload-ca takes effect
+// without restarting the listener.
+func buildTLSConfig() (*tls.Config, error) {
+	certPath := os.Getenv("TLS_CERT")
+	keyPath := os.Getenv("TLS_KEY")
+	if certPath == "" || keyPath == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if mtlsEnabled() {
+		pool, err := loadClientCAPool(os.Getenv("CLIENT_CA_BUNDLE"))
+		if err != nil {
+			return nil, err
+		}
+		clientCAPool.Store(pool)
+
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			perConn := cfg.Clone()
+			perConn.ClientCAs = clientCAPool.Load().(*x509.CertPool)
+			return perConn, nil
+		}
+	}
+
+	return cfg, nil
+}
+
+// AuthMiddleware validates API keys, or delegates to mTLS client
+// certificate authentication when CLIENT_CA_BUNDLE is configured.
 func authMiddleware() gin.HandlerFunc {
+	if mtlsEnabled() {
+		log.Println("CLIENT_CA_BUNDLE set - authenticating via mTLS client certificates")
+		return mtlsMiddleware()
+	}
+
+	if jwtAuthEnabled() {
+		log.Println("JWKS_URL set - authenticating via JWT bearer tokens")
+		return jwtAuthMiddleware()
+	}
+
 	// Get API key from environment
 	apiKey := os.Getenv("API_KEY")
 
@@ -1,19 +1,27 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
-// ProofCache implements an in-memory cache for generated proofs
-type ProofCache struct {
-	mu      sync.RWMutex
-	cache   map[string]*CachedProof
-	maxSize int
-	ttl     time.Duration
+// Cache is implemented by every proof cache backend: the process-local
+// in-memory cache and the Redis-backed distributed cache.
+type Cache interface {
+	Get(req *ProofRequest) (*ProofResponse, bool)
+	Set(req *ProofRequest, resp *ProofResponse)
+	Stats() map[string]interface{}
 }
 
 // CachedProof represents a cached proof with metadata
@@ -22,50 +30,59 @@ type CachedProof struct {
 	PublicInputs string
 	GeneratedAt  time.Time
 	AccessCount  int
+	LastAccess   time.Time
 }
 
-// NewProofCache creates a new proof cache
-func NewProofCache(maxSize int, ttl time.Duration) *ProofCache {
-	pc := &ProofCache{
+// generateCacheKey creates a cache key from proof request
+func generateCacheKey(req *ProofRequest) string {
+	// Create deterministic key from public inputs only
+	// (private inputs shouldn't affect cache key for same public constraints)
+	data := req.MinAmount + req.RecipientKey + req.MaxBlockAge
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
+
+// memoryCache implements Cache as a process-local, in-memory LRU.
+type memoryCache struct {
+	mu      sync.RWMutex
+	cache   map[string]*CachedProof
+	maxSize int
+	ttl     time.Duration
+}
+
+func newMemoryCache(maxSize int, ttl time.Duration) *memoryCache {
+	mc := &memoryCache{
 		cache:   make(map[string]*CachedProof),
 		maxSize: maxSize,
 		ttl:     ttl,
 	}
 
 	// Start cleanup goroutine
-	go pc.cleanup()
-
-	return pc
-}
+	go mc.cleanup()
 
-// generateKey creates a cache key from proof request
-func generateCacheKey(req *ProofRequest) string {
-	// Create deterministic key from public inputs only
-	// (private inputs shouldn't affect cache key for same public constraints)
-	data := req.MinAmount + req.RecipientKey + req.MaxBlockAge
-	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:])
+	return mc
 }
 
 // Get retrieves a cached proof if it exists and is still valid
-func (pc *ProofCache) Get(req *ProofRequest) (*ProofResponse, bool) {
+func (mc *memoryCache) Get(req *ProofRequest) (*ProofResponse, bool) {
 	key := generateCacheKey(req)
 
-	pc.mu.RLock()
-	defer pc.mu.RUnlock()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
 
-	cached, exists := pc.cache[key]
+	cached, exists := mc.cache[key]
 	if !exists {
 		return nil, false
 	}
 
 	// Check if expired
-	if time.Since(cached.GeneratedAt) > pc.ttl {
+	if time.Since(cached.GeneratedAt) > mc.ttl {
 		return nil, false
 	}
 
-	// Increment access count
+	// Track access for LRU eviction and stats
 	cached.AccessCount++
+	cached.LastAccess = time.Now()
 
 	return &ProofResponse{
 		Proof:          cached.Proof,
@@ -75,73 +92,270 @@ func (pc *ProofCache) Get(req *ProofRequest) (*ProofResponse, bool) {
 }
 
 // Set stores a proof in the cache
-func (pc *ProofCache) Set(req *ProofRequest, resp *ProofResponse) {
+func (mc *memoryCache) Set(req *ProofRequest, resp *ProofResponse) {
 	key := generateCacheKey(req)
 
-	pc.mu.Lock()
-	defer pc.mu.Unlock()
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
 
 	// Check if we need to evict
-	if len(pc.cache) >= pc.maxSize {
-		pc.evictLRU()
+	if len(mc.cache) >= mc.maxSize {
+		mc.evictLRU()
 	}
 
-	pc.cache[key] = &CachedProof{
+	now := time.Now()
+	mc.cache[key] = &CachedProof{
 		Proof:        resp.Proof,
 		PublicInputs: resp.PublicInputs,
-		GeneratedAt:  time.Now(),
+		GeneratedAt:  now,
 		AccessCount:  1,
+		LastAccess:   now,
 	}
 }
 
-// evictLRU evicts the least recently used item
-func (pc *ProofCache) evictLRU() {
+// evictLRU evicts the least recently accessed item. It's keyed on
+// LastAccess rather than GeneratedAt so a frequently-hit entry survives
+// eviction instead of being treated as FIFO.
+func (mc *memoryCache) evictLRU() {
 	var oldestKey string
-	var oldestTime time.Time = time.Now()
+	var oldestAccess time.Time = time.Now()
 
-	for key, cached := range pc.cache {
-		if cached.GeneratedAt.Before(oldestTime) {
-			oldestTime = cached.GeneratedAt
+	for key, cached := range mc.cache {
+		if cached.LastAccess.Before(oldestAccess) {
+			oldestAccess = cached.LastAccess
 			oldestKey = key
 		}
 	}
 
 	if oldestKey != "" {
-		delete(pc.cache, oldestKey)
+		delete(mc.cache, oldestKey)
 	}
 }
 
 // cleanup periodically removes expired entries
-func (pc *ProofCache) cleanup() {
+func (mc *memoryCache) cleanup() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		pc.mu.Lock()
+		mc.mu.Lock()
 		now := time.Now()
-		for key, cached := range pc.cache {
-			if now.Sub(cached.GeneratedAt) > pc.ttl {
-				delete(pc.cache, key)
+		for key, cached := range mc.cache {
+			if now.Sub(cached.GeneratedAt) > mc.ttl {
+				delete(mc.cache, key)
 			}
 		}
-		pc.mu.Unlock()
+		mc.mu.Unlock()
 	}
 }
 
 // Stats returns cache statistics
-func (pc *ProofCache) Stats() map[string]interface{} {
-	pc.mu.RLock()
-	defer pc.mu.RUnlock()
+func (mc *memoryCache) Stats() map[string]interface{} {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
 
 	totalAccess := 0
-	for _, cached := range pc.cache {
+	for _, cached := range mc.cache {
 		totalAccess += cached.AccessCount
 	}
 
 	return map[string]interface{}{
-		"size":         len(pc.cache),
-		"maxSize":      pc.maxSize,
-		"totalAccess":  totalAccess,
-		"ttlSeconds":   int(pc.ttl.Seconds()),
+		"backend":     "memory",
+		"size":        len(mc.cache),
+		"maxSize":     mc.maxSize,
+		"totalAccess": totalAccess,
+		"ttlSeconds":  int(mc.ttl.Seconds()),
 	}
 }
+
+// redisCachedProof is the JSON envelope stored under each cache key in
+// Redis, shared by every prover replica.
+type redisCachedProof struct {
+	Proof        string    `json:"proof"`
+	PublicInputs string    `json:"publicInputs"`
+	GeneratedAt  time.Time `json:"generatedAt"`
+}
+
+// RedisCache is a Cache backed by Redis, so a horizontally-scaled prover
+// fleet shares one proof cache instead of every replica recomputing
+// identical proofs.
+type RedisCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisCache connects to addr and returns a Cache backed by it.
+func NewRedisCache(addr string, ttl time.Duration) *RedisCache {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+
+	return &RedisCache{client: client, ttl: ttl}
+}
+
+func (rc *RedisCache) Get(req *ProofRequest) (*ProofResponse, bool) {
+	key := generateCacheKey(req)
+
+	data, err := rc.client.Get(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Redis cache lookup failed")
+		return nil, false
+	}
+
+	var cached redisCachedProof
+	if err := json.Unmarshal(data, &cached); err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Failed to decode cached proof from Redis")
+		return nil, false
+	}
+
+	return &ProofResponse{
+		Proof:          cached.Proof,
+		PublicInputs:   cached.PublicInputs,
+		GenerationTime: 0,
+	}, true
+}
+
+func (rc *RedisCache) Set(req *ProofRequest, resp *ProofResponse) {
+	key := generateCacheKey(req)
+
+	data, err := json.Marshal(redisCachedProof{
+		Proof:        resp.Proof,
+		PublicInputs: resp.PublicInputs,
+		GeneratedAt:  time.Now(),
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Failed to encode proof for Redis cache")
+		return
+	}
+
+	if err := rc.client.Set(context.Background(), key, data, rc.ttl).Err(); err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Failed to write proof to Redis cache")
+	}
+}
+
+func (rc *RedisCache) Stats() map[string]interface{} {
+	size, err := rc.client.DBSize(context.Background()).Result()
+	if err != nil {
+		size = -1
+	}
+
+	return map[string]interface{}{
+		"backend":    "redis",
+		"size":       size,
+		"ttlSeconds": int(rc.ttl.Seconds()),
+	}
+}
+
+// ProofCache is the cache used by the prover. It delegates storage to a
+// Cache backend (in-memory or Redis), optionally writes every entry through
+// to a size-bounded disk tier that Get falls back to on a backend miss,
+// and coalesces concurrent requests for the same proof with singleflight,
+// so N identical in-flight requests trigger only one witness+prove call
+// while the rest block on its result.
+type ProofCache struct {
+	backend Cache
+	disk    *diskTier
+	sf      singleflight.Group
+}
+
+// NewProofCache creates a new proof cache. If REDIS_ADDR is set, proofs are
+// shared across the prover fleet via Redis; otherwise the cache is
+// process-local. If DISK_CACHE_DIR is set, a disk tier backs the cache,
+// bounded by DISK_CACHE_MAX_BYTES (default 1GiB).
+func NewProofCache(maxSize int, ttl time.Duration) *ProofCache {
+	var backend Cache
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		backend = NewRedisCache(addr, ttl)
+	} else {
+		backend = newMemoryCache(maxSize, ttl)
+	}
+
+	pc := &ProofCache{backend: backend}
+
+	if dir := os.Getenv("DISK_CACHE_DIR"); dir != "" {
+		maxBytes := int64(1 << 30)
+		if v := os.Getenv("DISK_CACHE_MAX_BYTES"); v != "" {
+			if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
+				maxBytes = parsed
+			}
+		}
+
+		disk, err := newDiskTier(dir, maxBytes)
+		if err != nil {
+			log.WithFields(logrus.Fields{"error": err.Error()}).Error("Failed to initialize disk cache tier, continuing without it")
+		} else {
+			pc.disk = disk
+		}
+	}
+
+	return pc
+}
+
+func (pc *ProofCache) Get(req *ProofRequest) (*ProofResponse, bool) {
+	if resp, found := pc.backend.Get(req); found {
+		proofCacheHitsTotal.Inc()
+		return resp, true
+	}
+
+	if pc.disk != nil {
+		if resp, found := pc.disk.Get(generateCacheKey(req)); found {
+			proofCacheHitsTotal.Inc()
+			pc.backend.Set(req, resp) // promote to the faster tier
+			return resp, true
+		}
+	}
+
+	proofCacheMissesTotal.Inc()
+	return nil, false
+}
+
+func (pc *ProofCache) Set(req *ProofRequest, resp *ProofResponse) {
+	pc.backend.Set(req, resp)
+	if pc.disk != nil {
+		pc.disk.Set(generateCacheKey(req), resp)
+	}
+}
+
+func (pc *ProofCache) Stats() map[string]interface{} {
+	stats := pc.backend.Stats()
+	if pc.disk != nil {
+		for k, v := range pc.disk.Stats() {
+			stats[k] = v
+		}
+	}
+	return stats
+}
+
+// GetOrGenerate returns the cached proof for req if present. Otherwise it
+// calls generate, but coalesces concurrent calls for the same cache key so
+// only one of them actually runs generate; the rest block and receive its
+// result. The returned bool reports whether the proof came from cache.
+func (pc *ProofCache) GetOrGenerate(req *ProofRequest, generate func() (*ProofResponse, error)) (*ProofResponse, bool, error) {
+	if resp, found := pc.Get(req); found {
+		return resp, true, nil
+	}
+
+	key := generateCacheKey(req)
+	ranHere := false
+	v, err, shared := pc.sf.Do(key, func() (interface{}, error) {
+		ranHere = true
+		resp, err := generate()
+		if err != nil {
+			return nil, err
+		}
+		pc.Set(req, resp)
+		return resp, nil
+	})
+	if shared && !ranHere {
+		proofCacheCoalescedTotal.Inc()
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("proof generation failed: %w", err)
+	}
+
+	return v.(*ProofResponse), false, nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// VerifiedArtifact is what a trusted-setup ceremony artifact's signature
+// verification yields: the Fulcio-issued identity that signed it and where
+// that signature was logged in Rekor, so /health can report which ceremony
+// output the running binary trusts.
+type VerifiedArtifact struct {
+	SignerIdentity string `json:"signerIdentity"` // SAN from the Fulcio cert (e.g. a GitHub Actions workflow ref URI)
+	Issuer         string `json:"issuer"`         // OIDC issuer the Fulcio cert was issued against
+	RekorLogIndex  int64  `json:"rekorLogIndex"`
+}
+
+// rekorBundle is the JSON produced by `cosign sign-blob --bundle=...`: the
+// canonicalized Rekor log entry body plus a Signed Entry Timestamp (SET)
+// proving Rekor accepted and logged it.
+type rekorBundle struct {
+	SignedEntryTimestamp string       `json:"SignedEntryTimestamp"`
+	Payload              rekorPayload `json:"Payload"`
+}
+
+type rekorPayload struct {
+	Body           string `json:"body"` // base64 of the canonical hashedrekord entry JSON
+	IntegratedTime int64  `json:"integratedTime"`
+	LogIndex       int64  `json:"logIndex"`
+	LogID          string `json:"logID"`
+}
+
+// hashedRekordEntry is the "hashedrekord" entry body Rekor stores (base64
+// in rekorPayload.Body): the signature and signing certificate that were
+// submitted for logging, plus the hash of the blob they cover. It's used to
+// bind a Rekor inclusion proof to the specific signature/certificate being
+// verified, rather than trusting any SET logged within the cert's window.
+type hashedRekordEntry struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Signature struct {
+			Content   string `json:"content"` // base64 signature bytes
+			PublicKey struct {
+				Content string `json:"content"` // base64 of the signing cert's PEM
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// cosignRoots is the Fulcio root/intermediate CA pool plus Rekor's
+// transparency log public key, both read from the PEM bundle at
+// COSIGN_ROOTS. There are no embedded defaults: COSIGN_ROOTS must be set.
+type cosignRoots struct {
+	fulcio *x509.CertPool
+	rekor  *ecdsa.PublicKey
+}
+
+// loadCosignRoots parses COSIGN_ROOTS: a PEM bundle containing one or more
+// Fulcio CA certificates and at least one Rekor "PUBLIC KEY" block (if there
+// are several, the last one is used).
+func loadCosignRoots() (*cosignRoots, error) {
+	path := os.Getenv("COSIGN_ROOTS")
+	if path == "" {
+		return nil, fmt.Errorf("COSIGN_ROOTS not set - cannot verify trusted-setup signatures")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read COSIGN_ROOTS: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	var rekorPub *ecdsa.PublicKey
+
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse Fulcio root certificate: %w", err)
+			}
+			pool.AddCert(cert)
+		case "PUBLIC KEY":
+			pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse Rekor public key: %w", err)
+			}
+			ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("Rekor public key is not ECDSA")
+			}
+			rekorPub = ecdsaPub
+		}
+	}
+
+	if rekorPub == nil {
+		return nil, fmt.Errorf("COSIGN_ROOTS bundle has no Rekor public key")
+	}
+
+	return &cosignRoots{fulcio: pool, rekor: rekorPub}, nil
+}
+
+// verifyCeremonyArtifact verifies that blobPath was signed via cosign
+// keyless signing: the signature at "<blobPath>.sig" verifies against the
+// certificate at "<blobPath>.pem" using the blob's sha256 digest, that
+// certificate chains to roots.fulcio and its SAN/issuer match the
+// configured allowlist, and the Rekor bundle at "<blobPath>.rekor.json"
+// carries a Signed Entry Timestamp that verifies against roots.rekor and
+// was logged while the (short-lived) certificate was still valid.
+func verifyCeremonyArtifact(blobPath string, roots *cosignRoots) (*VerifiedArtifact, error) {
+	blob, err := os.ReadFile(blobPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+
+	sigB64, err := os.ReadFile(blobPath + ".sig")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact signature: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(sigB64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode artifact signature: %w", err)
+	}
+
+	certPEM, err := os.ReadFile(blobPath + ".pem")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing certificate: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("invalid signing certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+	}
+
+	// Fulcio certs are short-lived (minutes), so verify the chain as of the
+	// certificate's own validity window rather than wall-clock time.
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:       roots.fulcio,
+		CurrentTime: cert.NotBefore.Add(time.Minute),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, fmt.Errorf("signing certificate does not chain to a trusted Fulcio root: %w", err)
+	}
+
+	identity, issuer, err := certIdentity(cert)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignerAllowlist(identity, issuer); err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(blob)
+	ecdsaPub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("signing certificate key is not ECDSA")
+	}
+	if !ecdsa.VerifyASN1(ecdsaPub, digest[:], sig) {
+		return nil, fmt.Errorf("signature verification failed for %s", blobPath)
+	}
+
+	logIndex, err := verifyRekorInclusion(blobPath+".rekor.json", sigB64, certPEM, roots.rekor, cert)
+	if err != nil {
+		return nil, fmt.Errorf("rekor transparency log verification failed: %w", err)
+	}
+
+	return &VerifiedArtifact{
+		SignerIdentity: identity,
+		Issuer:         issuer,
+		RekorLogIndex:  logIndex,
+	}, nil
+}
+
+// fulcioOIDCIssuerOID is the X.509 extension Fulcio stamps the OIDC issuer
+// into (RFC: "Fulcio OID extensions", 1.3.6.1.4.1.57264.1.1 in the v1
+// extension schema).
+var fulcioOIDCIssuerOID = []int{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+
+// certIdentity extracts the signer's identity (first URI SAN, matching
+// cosign's convention of encoding the workflow/job identity there) and the
+// OIDC issuer Fulcio embedded in the certificate.
+func certIdentity(cert *x509.Certificate) (identity, issuer string, err error) {
+	if len(cert.URIs) == 0 {
+		return "", "", fmt.Errorf("signing certificate has no URI SAN identity")
+	}
+	identity = cert.URIs[0].String()
+
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(fulcioOIDCIssuerOID) {
+			return identity, string(ext.Value), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("signing certificate has no Fulcio OIDC issuer extension")
+}
+
+// checkSignerAllowlist requires identity and issuer to exactly match
+// COSIGN_ALLOWED_SAN / COSIGN_ALLOWED_ISSUER, so only a specific ceremony
+// workflow's signature is trusted.
+func checkSignerAllowlist(identity, issuer string) error {
+	allowedSAN := os.Getenv("COSIGN_ALLOWED_SAN")
+	allowedIssuer := os.Getenv("COSIGN_ALLOWED_ISSUER")
+
+	if allowedSAN == "" || allowedIssuer == "" {
+		return fmt.Errorf("COSIGN_ALLOWED_SAN and COSIGN_ALLOWED_ISSUER must be configured")
+	}
+	if identity != allowedSAN {
+		return fmt.Errorf("signer identity %q is not in the allowlist", identity)
+	}
+	if issuer != allowedIssuer {
+		return fmt.Errorf("OIDC issuer %q is not in the allowlist", issuer)
+	}
+
+	return nil
+}
+
+// verifyRekorInclusion verifies the Signed Entry Timestamp in the bundle at
+// rekorJSONPath against rekorPub, confirming Rekor itself vouches for
+// having logged this exact (signature, certificate) pair, and that it did
+// so while cert was still valid.
+func verifyRekorInclusion(rekorJSONPath string, sigB64, certPEM []byte, rekorPub *ecdsa.PublicKey, cert *x509.Certificate) (int64, error) {
+	data, err := os.ReadFile(rekorJSONPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rekor bundle: %w", err)
+	}
+
+	var bundle rekorBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return 0, fmt.Errorf("failed to parse rekor bundle: %w", err)
+	}
+
+	set, err := base64.StdEncoding.DecodeString(bundle.SignedEntryTimestamp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode signed entry timestamp: %w", err)
+	}
+
+	// Rekor computes the SET over the payload as RFC 8785 canonical JSON,
+	// i.e. object keys in lexicographic order ("body", "integratedTime",
+	// "logID", "logIndex") - NOT the struct's declaration order. Marshaling
+	// a map instead of the struct gets that ordering for free, since
+	// encoding/json sorts map[string]any keys when marshaling.
+	canonicalPayload, err := json.Marshal(map[string]interface{}{
+		"body":           bundle.Payload.Body,
+		"integratedTime": bundle.Payload.IntegratedTime,
+		"logID":          bundle.Payload.LogID,
+		"logIndex":       bundle.Payload.LogIndex,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to canonicalize rekor payload: %w", err)
+	}
+	digest := sha256.Sum256(canonicalPayload)
+
+	if !ecdsa.VerifyASN1(rekorPub, digest[:], set) {
+		return 0, fmt.Errorf("signed entry timestamp does not verify against the configured Rekor key")
+	}
+
+	if err := verifyRekorEntryBinding(bundle.Payload.Body, sigB64, certPEM); err != nil {
+		return 0, fmt.Errorf("rekor entry does not match the artifact being verified: %w", err)
+	}
+
+	integratedAt := time.Unix(bundle.Payload.IntegratedTime, 0)
+	if integratedAt.Before(cert.NotBefore) || integratedAt.After(cert.NotAfter) {
+		return 0, fmt.Errorf("rekor entry was logged at %s, outside the certificate's validity window", integratedAt)
+	}
+
+	return bundle.Payload.LogIndex, nil
+}
+
+// verifyRekorEntryBinding decodes bodyB64 (the base64 hashedrekord entry
+// from rekorPayload.Body) and asserts its signature and signing certificate
+// are exactly the ones being verified. Without this, a valid SET for *any*
+// hashedrekord entry logged within the certificate's validity window would
+// be accepted, since the SET only proves Rekor logged *something* - it
+// doesn't by itself prove what it logged was this signature/certificate.
+func verifyRekorEntryBinding(bodyB64 string, sigB64, certPEM []byte) error {
+	bodyJSON, err := base64.StdEncoding.DecodeString(bodyB64)
+	if err != nil {
+		return fmt.Errorf("failed to decode rekor entry body: %w", err)
+	}
+
+	var entry hashedRekordEntry
+	if err := json.Unmarshal(bodyJSON, &entry); err != nil {
+		return fmt.Errorf("failed to parse rekor entry body: %w", err)
+	}
+	if entry.Kind != "hashedrekord" {
+		return fmt.Errorf("unexpected rekor entry kind %q", entry.Kind)
+	}
+
+	entrySig, err := base64.StdEncoding.DecodeString(entry.Spec.Signature.Content)
+	if err != nil {
+		return fmt.Errorf("failed to decode rekor entry signature: %w", err)
+	}
+	wantSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigB64)))
+	if err != nil {
+		return fmt.Errorf("failed to decode artifact signature: %w", err)
+	}
+	if !bytes.Equal(entrySig, wantSig) {
+		return fmt.Errorf("logged signature does not match the artifact signature")
+	}
+
+	entryCertPEM, err := base64.StdEncoding.DecodeString(entry.Spec.Signature.PublicKey.Content)
+	if err != nil {
+		return fmt.Errorf("failed to decode rekor entry certificate: %w", err)
+	}
+	entryBlock, _ := pem.Decode(entryCertPEM)
+	wantBlock, _ := pem.Decode(certPEM)
+	if entryBlock == nil || wantBlock == nil || !bytes.Equal(entryBlock.Bytes, wantBlock.Bytes) {
+		return fmt.Errorf("logged certificate does not match the signing certificate")
+	}
+
+	return nil
+}
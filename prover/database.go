@@ -1,19 +1,21 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
-	"encoding/json"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
-type ProofDatabase struct {
-	db *sql.DB
-}
-
+// ProofRecord mirrors a row of the proofs table, shared across every
+// ProofStore implementation.
 type ProofRecord struct {
 	ID             int64
 	RequestHash    string
@@ -25,257 +27,368 @@ type ProofRecord struct {
 	ExpiresAt      time.Time
 }
 
-func NewProofDatabase() (*ProofDatabase, error) {
-	dbPath := os.Getenv("DATABASE_PATH")
-	if dbPath == "" {
-		dbPath = "./proofs.db"
-	}
+// ProofStore persists generated proofs and the rate-limit/usage bookkeeping
+// around them. Implementations own their dialect's DDL, migration
+// bootstrap, and connection pool tuning; the rest of the service only ever
+// talks to this interface, selected at startup by NewProofDatabase.
+//
+// StoreProof, GetProof, and LogRateLimitExceeded are ctx.Background()
+// wrappers around their Context counterparts, kept for callers that don't
+// have a request context handy; HTTP handlers should prefer the Context
+// variants so a client disconnect or deadline aborts the underlying query
+// instead of leaving it to run to completion.
+type ProofStore interface {
+	StoreProofContext(ctx context.Context, req *ProofRequest, resp *ProofResponse, clientIP string, ttl time.Duration) error
+	StoreProof(req *ProofRequest, resp *ProofResponse, clientIP string, ttl time.Duration) error
+	GetProofContext(ctx context.Context, req *ProofRequest) (*ProofResponse, bool, error)
+	GetProof(req *ProofRequest) (*ProofResponse, bool, error)
+	LogRateLimitExceededContext(ctx context.Context, clientIP, endpoint string) error
+	LogRateLimitExceeded(clientIP, endpoint string) error
+	CleanupExpiredProofs() error
+	GetStats() (map[string]interface{}, error)
+	Close() error
+}
 
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+// NewProofDatabase dispatches to the ProofStore implementation selected by
+// DATABASE_DRIVER: "sqlite" (default, single-node), "postgres", or "mysql"
+// for clustered deployments where every replica needs to share one store.
+func NewProofDatabase() (ProofStore, error) {
+	switch driver := os.Getenv("DATABASE_DRIVER"); driver {
+	case "", "sqlite":
+		return newSQLiteProofStore()
+	case "postgres":
+		return newPostgresProofStore()
+	case "mysql":
+		return newMySQLProofStore()
+	default:
+		return nil, fmt.Errorf("unknown DATABASE_DRIVER %q (expected sqlite, postgres, or mysql)", driver)
 	}
+}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+// requestHashVersion domain-separates generateRequestHash's digest from any
+// other hash computed over similarly-shaped data elsewhere in the service,
+// and lets a future field addition bump to "umbra-proof-v2" without
+// colliding with hashes computed under the old field set.
+const requestHashVersion = "umbra-proof-v1"
 
-	// Test connection
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+// generateRequestHash builds a deterministic key identifying req, used to
+// look up a previously stored proof for an identical request. Each field is
+// length-prefixed before being hashed so that, say, SenderKeyX="12"+SenderKeyY="3"
+// can never hash the same as SenderKeyX="1"+SenderKeyY="23".
+func generateRequestHash(req *ProofRequest) string {
+	h := sha256.New()
+	h.Write([]byte(requestHashVersion))
+
+	writeField := func(s string) {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(s)))
+		h.Write(length[:])
+		h.Write([]byte(s))
 	}
 
-	proofDB := &ProofDatabase{db: db}
+	writeField(req.MinAmount)
+	writeField(req.RecipientKeyX)
+	writeField(req.RecipientKeyY)
+	writeField(req.MaxBlockAge)
+	writeField(strconv.FormatInt(req.CurrentTime, 10))
+	writeField(req.ActualAmount)
+	writeField(req.SenderKeyX)
+	writeField(req.SenderKeyY)
+	writeField(strconv.FormatInt(req.PaymentTime, 10))
+	writeField(req.SignatureR8X)
+	writeField(req.SignatureR8Y)
+	writeField(req.SignatureS)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// StartCleanupWorker runs a background job to clean up expired proofs. It
+// stops as soon as ctx is canceled, and returns a shutdown func that cancels
+// the worker (if ctx hasn't already been) and blocks until its goroutine has
+// exited - callers must call shutdown, and wait for it to return, before
+// calling store.Close(), or the worker can run a query against a closed
+// *sql.DB and panic.
+func StartCleanupWorker(ctx context.Context, store ProofStore) (shutdown func(context.Context) error) {
+	workerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-workerCtx.Done():
+				return
+			case <-ticker.C:
+				if err := store.CleanupExpiredProofs(); err != nil {
+					log.WithFields(logrus.Fields{
+						"error": err.Error(),
+					}).Error("Failed to cleanup expired proofs")
+				}
+			}
+		}
+	}()
+
+	log.Info("Database cleanup worker started (runs every 1 hour)")
 
-	// Initialize schema
-	if err := proofDB.initSchema(); err != nil {
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	return func(shutdownCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-shutdownCtx.Done():
+			return shutdownCtx.Err()
+		}
 	}
+}
 
-	log.WithFields(logrus.Fields{
-		"database_path": dbPath,
-	}).Info("Database initialized")
+// defaultCleanupBatchSize/Sleep/KeepLast are the out-of-the-box cleanup
+// knobs, used when their corresponding environment variable is unset.
+const (
+	defaultCleanupBatchSize = 100
+	defaultCleanupSleep     = time.Minute
+	defaultCleanupKeepLast  = 0
+)
 
-	return proofDB, nil
+// cleanupBatchSize returns CLEANUP_BATCH_SIZE, the maximum number of rows a
+// single cleanup DELETE removes, so a busy table never takes one long lock.
+func cleanupBatchSize() int {
+	if v := os.Getenv("CLEANUP_BATCH_SIZE"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return defaultCleanupBatchSize
 }
 
-func (pdb *ProofDatabase) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS proofs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		request_hash TEXT NOT NULL UNIQUE,
-		proof TEXT NOT NULL,
-		public_inputs TEXT NOT NULL,
-		client_ip TEXT NOT NULL,
-		generation_time_ms INTEGER NOT NULL,
-		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		expires_at TIMESTAMP NOT NULL,
-		INDEX idx_request_hash (request_hash),
-		INDEX idx_created_at (created_at),
-		INDEX idx_expires_at (expires_at)
-	);
-
-	CREATE TABLE IF NOT EXISTS proof_verifications (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		proof_id INTEGER NOT NULL,
-		client_ip TEXT NOT NULL,
-		verified_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		verification_result TEXT NOT NULL,
-		FOREIGN KEY (proof_id) REFERENCES proofs(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS rate_limit_log (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		client_ip TEXT NOT NULL,
-		endpoint TEXT NOT NULL,
-		exceeded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		INDEX idx_client_ip (client_ip),
-		INDEX idx_exceeded_at (exceeded_at)
-	);
-	`
-
-	_, err := pdb.db.Exec(schema)
-	return err
+// cleanupSleep returns CLEANUP_SLEEP, how long the cleanup loop pauses
+// between batches to let other queries through.
+func cleanupSleep() time.Duration {
+	if v := os.Getenv("CLEANUP_SLEEP"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return defaultCleanupSleep
 }
 
-func (pdb *ProofDatabase) StoreProof(req *ProofRequest, resp *ProofResponse, clientIP string, ttl time.Duration) error {
-	requestHash := generateRequestHash(req)
+// cleanupKeepLast returns CLEANUP_KEEP_LAST: proofs created more recently
+// than this are never deleted, even once expired, so a clock skew or a
+// too-short TTL can't wipe out proofs operators still want around to
+// investigate.
+func cleanupKeepLast() time.Duration {
+	if v := os.Getenv("CLEANUP_KEEP_LAST"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil && parsed >= 0 {
+			return parsed
+		}
+	}
+	return defaultCleanupKeepLast
+}
 
-	expiresAt := time.Now().Add(ttl)
+// runBatchedCleanup repeatedly calls deleteBatch - which should delete at
+// most batchSize rows matching "expires_at < now AND created_at < now -
+// keepLast" and return how many it removed - sleeping between batches,
+// until a batch deletes fewer than batchSize rows (including 0).
+func runBatchedCleanup(deleteBatch func(expiresBefore, createdBefore time.Time, limit int) (int64, error)) error {
+	batchSize := cleanupBatchSize()
+	sleep := cleanupSleep()
+	keepLast := cleanupKeepLast()
+
+	now := time.Now()
+	expiresBefore := now
+	createdBefore := now.Add(-keepLast)
+
+	var totalDeleted int64
+	for {
+		deleted, err := deleteBatch(expiresBefore, createdBefore, batchSize)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			break
+		}
 
-	query := `
-		INSERT OR REPLACE INTO proofs
-		(request_hash, proof, public_inputs, client_ip, generation_time_ms, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`
+		totalDeleted += deleted
+		if deleted < int64(batchSize) {
+			break
+		}
 
-	_, err := pdb.db.Exec(
-		query,
-		requestHash,
-		resp.Proof,
-		resp.PublicInputs,
-		clientIP,
-		resp.GenerationTime,
-		expiresAt,
-	)
+		time.Sleep(sleep)
+	}
 
-	if err != nil {
+	if totalDeleted > 0 {
 		log.WithFields(logrus.Fields{
-			"error":        err.Error(),
-			"request_hash": requestHash,
-		}).Error("Failed to store proof in database")
-		return err
+			"rows_deleted": totalDeleted,
+		}).Info("Cleaned up expired proofs")
 	}
 
-	log.WithFields(logrus.Fields{
-		"request_hash": requestHash,
-		"client_ip":    clientIP,
-		"expires_at":   expiresAt,
-	}).Debug("Proof stored in database")
-
 	return nil
 }
 
-func (pdb *ProofDatabase) GetProof(req *ProofRequest) (*ProofResponse, bool, error) {
-	requestHash := generateRequestHash(req)
+// runCleanupCLI runs a single batched cleanup pass against the ProofStore
+// selected by DATABASE_DRIVER and exits, honoring the same
+// CLEANUP_BATCH_SIZE / CLEANUP_SLEEP / CLEANUP_KEEP_LAST knobs as the
+// in-process worker, so operators can also drive cleanup from cron.
+func runCleanupCLI(args []string) {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	fs.Parse(args)
 
-	query := `
-		SELECT proof, public_inputs, generation_time_ms, expires_at
-		FROM proofs
-		WHERE request_hash = ? AND expires_at > datetime('now')
-	`
+	store, err := NewProofDatabase()
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer store.Close()
 
-	var proof, publicInputs string
-	var generationTime int64
-	var expiresAt time.Time
+	if err := store.CleanupExpiredProofs(); err != nil {
+		log.Fatalf("Cleanup failed: %v", err)
+	}
 
-	err := pdb.db.QueryRow(query, requestHash).Scan(&proof, &publicInputs, &generationTime, &expiresAt)
+	log.Println("Cleanup pass complete")
+}
 
-	if err == sql.ErrNoRows {
-		return nil, false, nil
-	}
+// defaultLRUFlushInterval is how often a store's accessTracker batches up
+// pending last-accessed timestamps into a single write.
+const defaultLRUFlushInterval = 5 * time.Second
 
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"error":        err.Error(),
-			"request_hash": requestHash,
-		}).Error("Failed to retrieve proof from database")
-		return nil, false, err
+// lruFlushInterval returns LRU_FLUSH_INTERVAL.
+func lruFlushInterval() time.Duration {
+	if v := os.Getenv("LRU_FLUSH_INTERVAL"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil && parsed > 0 {
+			return parsed
+		}
 	}
+	return defaultLRUFlushInterval
+}
 
-	response := &ProofResponse{
-		Proof:          proof,
-		PublicInputs:   publicInputs,
-		GenerationTime: 0, // Cached, so 0ms
+// maxCachedProofs returns MAX_CACHED_PROOFS, the row count above which the
+// cleanup worker starts evicting the least-recently-accessed proofs. 0
+// (the default) disables LRU eviction; only expired-proof cleanup runs.
+func maxCachedProofs() int {
+	if v := os.Getenv("MAX_CACHED_PROOFS"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			return parsed
+		}
 	}
+	return 0
+}
 
-	log.WithFields(logrus.Fields{
-		"request_hash": requestHash,
-	}).Debug("Proof retrieved from database")
+// accessTracker debounces last_accessed_at updates: GetProof hits call mark
+// instead of writing immediately, and a background loop flushes the
+// deduplicated set of (request_hash -> most recent access time) on a timer.
+// Without this, a high-QPS verifier turns every cache hit into a write.
+type accessTracker struct {
+	mu      sync.Mutex
+	pending map[string]time.Time
+	flush   func(map[string]time.Time) error
+}
 
-	return response, true, nil
+func newAccessTracker(flush func(map[string]time.Time) error) *accessTracker {
+	t := &accessTracker{
+		pending: make(map[string]time.Time),
+		flush:   flush,
+	}
+	go t.loop()
+	return t
 }
 
-func (pdb *ProofDatabase) LogRateLimitExceeded(clientIP, endpoint string) error {
-	query := `INSERT INTO rate_limit_log (client_ip, endpoint) VALUES (?, ?)`
-	_, err := pdb.db.Exec(query, clientIP, endpoint)
-	return err
+func (t *accessTracker) mark(requestHash string) {
+	t.mu.Lock()
+	t.pending[requestHash] = time.Now()
+	t.mu.Unlock()
 }
 
-func (pdb *ProofDatabase) CleanupExpiredProofs() error {
-	query := `DELETE FROM proofs WHERE expires_at < datetime('now')`
-	result, err := pdb.db.Exec(query)
+func (t *accessTracker) loop() {
+	ticker := time.NewTicker(lruFlushInterval())
+	defer ticker.Stop()
 
-	if err != nil {
-		return err
+	for range ticker.C {
+		t.flushNow()
 	}
+}
 
-	rowsDeleted, _ := result.RowsAffected()
+// flushNow writes out whatever accesses have accumulated since the last
+// flush. Safe to call from the Close path to avoid losing the last
+// sub-interval of access times.
+func (t *accessTracker) flushNow() {
+	t.mu.Lock()
+	if len(t.pending) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	batch := t.pending
+	t.pending = make(map[string]time.Time)
+	t.mu.Unlock()
 
-	if rowsDeleted > 0 {
+	if err := t.flush(batch); err != nil {
 		log.WithFields(logrus.Fields{
-			"rows_deleted": rowsDeleted,
-		}).Info("Cleaned up expired proofs")
+			"error": err.Error(),
+		}).Warn("Failed to flush proof access times")
 	}
-
-	return nil
 }
 
-func (pdb *ProofDatabase) GetStats() (map[string]interface{}, error) {
-	stats := make(map[string]interface{})
-
-	// Count total proofs
-	var totalProofs int64
-	err := pdb.db.QueryRow("SELECT COUNT(*) FROM proofs").Scan(&totalProofs)
-	if err != nil {
-		return nil, err
+// runLRUEviction evicts the least-recently-accessed rows, in batches, until
+// countRows is at or below MAX_CACHED_PROOFS (a no-op if that's unset). It
+// returns the total number of rows evicted.
+func runLRUEviction(countRows func() (int64, error), deleteOldest func(limit int) (int64, error)) (int64, error) {
+	maxRows := maxCachedProofs()
+	if maxRows <= 0 {
+		return 0, nil
 	}
-	stats["total_proofs"] = totalProofs
 
-	// Count active proofs (not expired)
-	var activeProofs int64
-	err = pdb.db.QueryRow("SELECT COUNT(*) FROM proofs WHERE expires_at > datetime('now')").Scan(&activeProofs)
-	if err != nil {
-		return nil, err
-	}
-	stats["active_proofs"] = activeProofs
+	batchSize := cleanupBatchSize()
+	var totalEvicted int64
 
-	// Count expired proofs
-	var expiredProofs int64
-	err = pdb.db.QueryRow("SELECT COUNT(*) FROM proofs WHERE expires_at <= datetime('now')").Scan(&expiredProofs)
-	if err != nil {
-		return nil, err
-	}
-	stats["expired_proofs"] = expiredProofs
+	for {
+		count, err := countRows()
+		if err != nil {
+			return totalEvicted, err
+		}
 
-	// Count rate limit violations (last 24 hours)
-	var rateLimitViolations int64
-	err = pdb.db.QueryRow("SELECT COUNT(*) FROM rate_limit_log WHERE exceeded_at > datetime('now', '-1 day')").Scan(&rateLimitViolations)
-	if err != nil {
-		return nil, err
-	}
-	stats["rate_limit_violations_24h"] = rateLimitViolations
+		overflow := count - int64(maxRows)
+		if overflow <= 0 {
+			return totalEvicted, nil
+		}
 
-	return stats, nil
-}
+		limit := batchSize
+		if overflow < int64(batchSize) {
+			limit = int(overflow)
+		}
 
-func (pdb *ProofDatabase) Close() error {
-	return pdb.db.Close()
-}
+		deleted, err := deleteOldest(limit)
+		if err != nil {
+			return totalEvicted, err
+		}
+		if deleted == 0 {
+			return totalEvicted, nil
+		}
 
-func generateRequestHash(req *ProofRequest) string {
-	// Create deterministic hash from request
-	data := fmt.Sprintf("%s:%s:%s:%d:%s:%s:%s:%d:%s",
-		req.MinAmount,
-		req.RecipientKey,
-		req.MaxBlockAge,
-		req.CurrentTime,
-		req.ActualAmount,
-		req.SenderKey,
-		req.TxHash,
-		req.PaymentTime,
-		req.Signature,
-	)
-
-	// Simple hash (in production, use SHA256)
-	hash := fmt.Sprintf("%x", []byte(data))
-	return hash[:64] // Limit to 64 chars
+		totalEvicted += deleted
+		time.Sleep(cleanupSleep())
+	}
 }
 
-// StartCleanupWorker runs a background job to clean up expired proofs
-func (pdb *ProofDatabase) StartCleanupWorker() {
-	ticker := time.NewTicker(1 * time.Hour)
+// scanProofRow is the common shape a GetProof query's row takes across
+// drivers, so each implementation's GetProof only differs in its SQL, not
+// its result handling.
+func scanProofRow(row *sql.Row) (*ProofResponse, bool, error) {
+	var proof, publicInputs string
+	var generationTime int64
+	var expiresAt time.Time
 
-	go func() {
-		for range ticker.C {
-			if err := pdb.CleanupExpiredProofs(); err != nil {
-				log.WithFields(logrus.Fields{
-					"error": err.Error(),
-				}).Error("Failed to cleanup expired proofs")
-			}
-		}
-	}()
+	err := row.Scan(&proof, &publicInputs, &generationTime, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
 
-	log.Info("Database cleanup worker started (runs every 1 hour)")
+	return &ProofResponse{
+		Proof:          proof,
+		PublicInputs:   publicInputs,
+		GenerationTime: 0, // Cached, so 0ms
+	}, true, nil
 }
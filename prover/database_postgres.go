@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresProofStore is the ProofStore backend for clustered deployments:
+// every prover replica points at the same Postgres instance, so a proof
+// generated by one replica is served from cache by any other.
+type postgresProofStore struct {
+	db     *sql.DB
+	access *accessTracker
+
+	storeProofStmt   *sql.Stmt
+	getProofStmt     *sql.Stmt
+	logRateLimitStmt *sql.Stmt
+
+	evictedLRUTotal       int64 // atomic
+	lastAccessWritesTotal int64 // atomic
+}
+
+func newPostgresProofStore() (*postgresProofStore, error) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		return nil, fmt.Errorf("DATABASE_DSN must be set for DATABASE_DRIVER=postgres")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	store := &postgresProofStore{db: db}
+	store.access = newAccessTracker(store.flushAccessTimes)
+
+	if err := store.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	if err := store.prepareStatements(); err != nil {
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"database_driver": "postgres",
+	}).Info("Database initialized")
+
+	return store, nil
+}
+
+// prepareStatements prepares the hot-path queries once at startup instead of
+// leaving db.Exec to re-parse and re-plan the same SQL on every call.
+func (s *postgresProofStore) prepareStatements() error {
+	var err error
+
+	s.storeProofStmt, err = s.db.Prepare(`
+		INSERT INTO proofs
+		(request_hash, proof, public_inputs, client_ip, generation_time_ms, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (request_hash) DO UPDATE SET
+			proof = EXCLUDED.proof,
+			public_inputs = EXCLUDED.public_inputs,
+			client_ip = EXCLUDED.client_ip,
+			generation_time_ms = EXCLUDED.generation_time_ms,
+			expires_at = EXCLUDED.expires_at
+	`)
+	if err != nil {
+		return err
+	}
+
+	s.getProofStmt, err = s.db.Prepare(`
+		SELECT proof, public_inputs, generation_time_ms, expires_at
+		FROM proofs
+		WHERE request_hash = $1 AND expires_at > NOW()
+	`)
+	if err != nil {
+		return err
+	}
+
+	s.logRateLimitStmt, err = s.db.Prepare(`INSERT INTO rate_limit_log (client_ip, endpoint) VALUES ($1, $2)`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *postgresProofStore) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS proofs (
+		id BIGSERIAL PRIMARY KEY,
+		request_hash TEXT NOT NULL UNIQUE,
+		proof TEXT NOT NULL,
+		public_inputs TEXT NOT NULL,
+		client_ip TEXT NOT NULL,
+		generation_time_ms BIGINT NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		last_accessed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_request_hash ON proofs (request_hash);
+	CREATE INDEX IF NOT EXISTS idx_created_at ON proofs (created_at);
+	CREATE INDEX IF NOT EXISTS idx_expires_at ON proofs (expires_at);
+	CREATE INDEX IF NOT EXISTS idx_last_accessed_at ON proofs (last_accessed_at);
+
+	CREATE TABLE IF NOT EXISTS proof_verifications (
+		id BIGSERIAL PRIMARY KEY,
+		proof_id BIGINT NOT NULL REFERENCES proofs(id) ON DELETE CASCADE,
+		client_ip TEXT NOT NULL,
+		verified_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		verification_result TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS rate_limit_log (
+		id BIGSERIAL PRIMARY KEY,
+		client_ip TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		exceeded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS idx_client_ip ON rate_limit_log (client_ip);
+	CREATE INDEX IF NOT EXISTS idx_exceeded_at ON rate_limit_log (exceeded_at);
+	`
+
+	_, err := s.db.Exec(schema)
+	return err
+}
+
+func (s *postgresProofStore) StoreProof(req *ProofRequest, resp *ProofResponse, clientIP string, ttl time.Duration) error {
+	return s.StoreProofContext(context.Background(), req, resp, clientIP, ttl)
+}
+
+func (s *postgresProofStore) StoreProofContext(ctx context.Context, req *ProofRequest, resp *ProofResponse, clientIP string, ttl time.Duration) error {
+	requestHash := generateRequestHash(req)
+	expiresAt := time.Now().Add(ttl)
+
+	_, err := s.storeProofStmt.ExecContext(
+		ctx,
+		requestHash,
+		resp.Proof,
+		resp.PublicInputs,
+		clientIP,
+		resp.GenerationTime,
+		expiresAt,
+	)
+
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error":        err.Error(),
+			"request_hash": requestHash,
+		}).Error("Failed to store proof in database")
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"request_hash": requestHash,
+		"client_ip":    clientIP,
+		"expires_at":   expiresAt,
+	}).Debug("Proof stored in database")
+
+	return nil
+}
+
+func (s *postgresProofStore) GetProof(req *ProofRequest) (*ProofResponse, bool, error) {
+	return s.GetProofContext(context.Background(), req)
+}
+
+func (s *postgresProofStore) GetProofContext(ctx context.Context, req *ProofRequest) (*ProofResponse, bool, error) {
+	requestHash := generateRequestHash(req)
+
+	response, found, err := scanProofRow(s.getProofStmt.QueryRowContext(ctx, requestHash))
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error":        err.Error(),
+			"request_hash": requestHash,
+		}).Error("Failed to retrieve proof from database")
+		return nil, false, err
+	}
+	if found {
+		log.WithFields(logrus.Fields{
+			"request_hash": requestHash,
+		}).Debug("Proof retrieved from database")
+		s.access.mark(requestHash)
+	}
+
+	return response, found, nil
+}
+
+// flushAccessTimes batches a set of debounced last_accessed_at updates into
+// a single transaction.
+func (s *postgresProofStore) flushAccessTimes(batch map[string]time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`UPDATE proofs SET last_accessed_at = $1 WHERE request_hash = $2`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for requestHash, accessedAt := range batch {
+		if _, err := stmt.Exec(accessedAt, requestHash); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	atomic.AddInt64(&s.lastAccessWritesTotal, int64(len(batch)))
+	return tx.Commit()
+}
+
+func (s *postgresProofStore) LogRateLimitExceeded(clientIP, endpoint string) error {
+	return s.LogRateLimitExceededContext(context.Background(), clientIP, endpoint)
+}
+
+func (s *postgresProofStore) LogRateLimitExceededContext(ctx context.Context, clientIP, endpoint string) error {
+	_, err := s.logRateLimitStmt.ExecContext(ctx, clientIP, endpoint)
+	return err
+}
+
+// CleanupExpiredProofs deletes expired proofs in bounded batches (see
+// runBatchedCleanup), then evicts the least-recently-accessed proofs down
+// to MAX_CACHED_PROOFS, if configured.
+func (s *postgresProofStore) CleanupExpiredProofs() error {
+	if err := runBatchedCleanup(func(expiresBefore, createdBefore time.Time, limit int) (int64, error) {
+		query := `
+			DELETE FROM proofs
+			WHERE id IN (
+				SELECT id FROM proofs
+				WHERE expires_at < $1 AND created_at < $2
+				LIMIT $3
+			)
+		`
+		result, err := s.db.Exec(query, expiresBefore, createdBefore, limit)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}); err != nil {
+		return err
+	}
+
+	evicted, err := runLRUEviction(
+		func() (int64, error) {
+			var count int64
+			err := s.db.QueryRow("SELECT COUNT(*) FROM proofs").Scan(&count)
+			return count, err
+		},
+		func(limit int) (int64, error) {
+			query := `
+				DELETE FROM proofs
+				WHERE id IN (
+					SELECT id FROM proofs
+					ORDER BY last_accessed_at ASC
+					LIMIT $1
+				)
+			`
+			result, err := s.db.Exec(query, limit)
+			if err != nil {
+				return 0, err
+			}
+			return result.RowsAffected()
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if evicted > 0 {
+		atomic.AddInt64(&s.evictedLRUTotal, evicted)
+		log.WithFields(logrus.Fields{
+			"rows_evicted": evicted,
+		}).Info("Evicted least-recently-accessed proofs")
+	}
+
+	return nil
+}
+
+func (s *postgresProofStore) GetStats() (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+
+	var totalProofs int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM proofs").Scan(&totalProofs); err != nil {
+		return nil, err
+	}
+	stats["total_proofs"] = totalProofs
+
+	var activeProofs int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM proofs WHERE expires_at > NOW()").Scan(&activeProofs); err != nil {
+		return nil, err
+	}
+	stats["active_proofs"] = activeProofs
+
+	var expiredProofs int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM proofs WHERE expires_at <= NOW()").Scan(&expiredProofs); err != nil {
+		return nil, err
+	}
+	stats["expired_proofs"] = expiredProofs
+
+	var rateLimitViolations int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM rate_limit_log WHERE exceeded_at > NOW() - INTERVAL '1 day'").Scan(&rateLimitViolations); err != nil {
+		return nil, err
+	}
+	stats["rate_limit_violations_24h"] = rateLimitViolations
+	stats["evicted_lru_total"] = atomic.LoadInt64(&s.evictedLRUTotal)
+	stats["last_access_writes_total"] = atomic.LoadInt64(&s.lastAccessWritesTotal)
+
+	return stats, nil
+}
+
+func (s *postgresProofStore) Close() error {
+	s.access.flushNow()
+	s.storeProofStmt.Close()
+	s.getProofStmt.Close()
+	s.logRateLimitStmt.Close()
+	return s.db.Close()
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteProofStore is the default, single-node ProofStore backend.
+type sqliteProofStore struct {
+	db     *sql.DB
+	access *accessTracker
+
+	storeProofStmt   *sql.Stmt
+	getProofStmt     *sql.Stmt
+	logRateLimitStmt *sql.Stmt
+
+	evictedLRUTotal       int64 // atomic
+	lastAccessWritesTotal int64 // atomic
+}
+
+func newSQLiteProofStore() (*sqliteProofStore, error) {
+	dbPath := os.Getenv("DATABASE_PATH")
+	if dbPath == "" {
+		dbPath = "./proofs.db"
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Set connection pool settings
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	// Test connection
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	store := &sqliteProofStore{db: db}
+	store.access = newAccessTracker(store.flushAccessTimes)
+
+	if err := store.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	if err := store.prepareStatements(); err != nil {
+		return nil, fmt.Errorf("failed to prepare statements: %w", err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"database_path": dbPath,
+	}).Info("Database initialized")
+
+	return store, nil
+}
+
+// prepareStatements prepares the hot-path queries once at startup instead of
+// leaving db.Exec to re-parse and re-plan the same SQL on every call.
+func (s *sqliteProofStore) prepareStatements() error {
+	var err error
+
+	s.storeProofStmt, err = s.db.Prepare(`
+		INSERT OR REPLACE INTO proofs
+		(request_hash, proof, public_inputs, client_ip, generation_time_ms, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+
+	s.getProofStmt, err = s.db.Prepare(`
+		SELECT proof, public_inputs, generation_time_ms, expires_at
+		FROM proofs
+		WHERE request_hash = ? AND expires_at > datetime('now')
+	`)
+	if err != nil {
+		return err
+	}
+
+	s.logRateLimitStmt, err = s.db.Prepare(`INSERT INTO rate_limit_log (client_ip, endpoint) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *sqliteProofStore) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS proofs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_hash TEXT NOT NULL UNIQUE,
+		proof TEXT NOT NULL,
+		public_inputs TEXT NOT NULL,
+		client_ip TEXT NOT NULL,
+		generation_time_ms INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		last_accessed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_request_hash ON proofs (request_hash);
+	CREATE INDEX IF NOT EXISTS idx_created_at ON proofs (created_at);
+	CREATE INDEX IF NOT EXISTS idx_expires_at ON proofs (expires_at);
+	CREATE INDEX IF NOT EXISTS idx_last_accessed_at ON proofs (last_accessed_at);
+
+	CREATE TABLE IF NOT EXISTS proof_verifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		proof_id INTEGER NOT NULL,
+		client_ip TEXT NOT NULL,
+		verified_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		verification_result TEXT NOT NULL,
+		FOREIGN KEY (proof_id) REFERENCES proofs(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS rate_limit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		client_ip TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		exceeded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_client_ip ON rate_limit_log (client_ip);
+	CREATE INDEX IF NOT EXISTS idx_exceeded_at ON rate_limit_log (exceeded_at);
+	`
+
+	_, err := s.db.Exec(schema)
+	return err
+}
+
+func (s *sqliteProofStore) StoreProof(req *ProofRequest, resp *ProofResponse, clientIP string, ttl time.Duration) error {
+	return s.StoreProofContext(context.Background(), req, resp, clientIP, ttl)
+}
+
+func (s *sqliteProofStore) StoreProofContext(ctx context.Context, req *ProofRequest, resp *ProofResponse, clientIP string, ttl time.Duration) error {
+	requestHash := generateRequestHash(req)
+	expiresAt := time.Now().Add(ttl)
+
+	_, err := s.storeProofStmt.ExecContext(
+		ctx,
+		requestHash,
+		resp.Proof,
+		resp.PublicInputs,
+		clientIP,
+		resp.GenerationTime,
+		expiresAt,
+	)
+
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error":        err.Error(),
+			"request_hash": requestHash,
+		}).Error("Failed to store proof in database")
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"request_hash": requestHash,
+		"client_ip":    clientIP,
+		"expires_at":   expiresAt,
+	}).Debug("Proof stored in database")
+
+	return nil
+}
+
+func (s *sqliteProofStore) GetProof(req *ProofRequest) (*ProofResponse, bool, error) {
+	return s.GetProofContext(context.Background(), req)
+}
+
+func (s *sqliteProofStore) GetProofContext(ctx context.Context, req *ProofRequest) (*ProofResponse, bool, error) {
+	requestHash := generateRequestHash(req)
+
+	response, found, err := scanProofRow(s.getProofStmt.QueryRowContext(ctx, requestHash))
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error":        err.Error(),
+			"request_hash": requestHash,
+		}).Error("Failed to retrieve proof from database")
+		return nil, false, err
+	}
+	if found {
+		log.WithFields(logrus.Fields{
+			"request_hash": requestHash,
+		}).Debug("Proof retrieved from database")
+		s.access.mark(requestHash)
+	}
+
+	return response, found, nil
+}
+
+// flushAccessTimes batches a set of debounced last_accessed_at updates into
+// a single transaction.
+func (s *sqliteProofStore) flushAccessTimes(batch map[string]time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`UPDATE proofs SET last_accessed_at = ? WHERE request_hash = ?`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for requestHash, accessedAt := range batch {
+		if _, err := stmt.Exec(accessedAt, requestHash); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	atomic.AddInt64(&s.lastAccessWritesTotal, int64(len(batch)))
+	return tx.Commit()
+}
+
+func (s *sqliteProofStore) LogRateLimitExceeded(clientIP, endpoint string) error {
+	return s.LogRateLimitExceededContext(context.Background(), clientIP, endpoint)
+}
+
+func (s *sqliteProofStore) LogRateLimitExceededContext(ctx context.Context, clientIP, endpoint string) error {
+	_, err := s.logRateLimitStmt.ExecContext(ctx, clientIP, endpoint)
+	return err
+}
+
+// CleanupExpiredProofs deletes expired proofs in bounded batches (see
+// runBatchedCleanup), then evicts the least-recently-accessed proofs down
+// to MAX_CACHED_PROOFS, if configured.
+func (s *sqliteProofStore) CleanupExpiredProofs() error {
+	if err := runBatchedCleanup(func(expiresBefore, createdBefore time.Time, limit int) (int64, error) {
+		query := `
+			DELETE FROM proofs
+			WHERE id IN (
+				SELECT id FROM proofs
+				WHERE expires_at < ? AND created_at < ?
+				LIMIT ?
+			)
+		`
+		result, err := s.db.Exec(query, expiresBefore, createdBefore, limit)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}); err != nil {
+		return err
+	}
+
+	evicted, err := runLRUEviction(
+		func() (int64, error) {
+			var count int64
+			err := s.db.QueryRow("SELECT COUNT(*) FROM proofs").Scan(&count)
+			return count, err
+		},
+		func(limit int) (int64, error) {
+			query := `
+				DELETE FROM proofs
+				WHERE id IN (
+					SELECT id FROM proofs
+					ORDER BY last_accessed_at ASC
+					LIMIT ?
+				)
+			`
+			result, err := s.db.Exec(query, limit)
+			if err != nil {
+				return 0, err
+			}
+			return result.RowsAffected()
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if evicted > 0 {
+		atomic.AddInt64(&s.evictedLRUTotal, evicted)
+		log.WithFields(logrus.Fields{
+			"rows_evicted": evicted,
+		}).Info("Evicted least-recently-accessed proofs")
+	}
+
+	return nil
+}
+
+func (s *sqliteProofStore) GetStats() (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+
+	var totalProofs int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM proofs").Scan(&totalProofs); err != nil {
+		return nil, err
+	}
+	stats["total_proofs"] = totalProofs
+
+	var activeProofs int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM proofs WHERE expires_at > datetime('now')").Scan(&activeProofs); err != nil {
+		return nil, err
+	}
+	stats["active_proofs"] = activeProofs
+
+	var expiredProofs int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM proofs WHERE expires_at <= datetime('now')").Scan(&expiredProofs); err != nil {
+		return nil, err
+	}
+	stats["expired_proofs"] = expiredProofs
+
+	var rateLimitViolations int64
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM rate_limit_log WHERE exceeded_at > datetime('now', '-1 day')").Scan(&rateLimitViolations); err != nil {
+		return nil, err
+	}
+	stats["rate_limit_violations_24h"] = rateLimitViolations
+	stats["evicted_lru_total"] = atomic.LoadInt64(&s.evictedLRUTotal)
+	stats["last_access_writes_total"] = atomic.LoadInt64(&s.lastAccessWritesTotal)
+
+	return stats, nil
+}
+
+func (s *sqliteProofStore) Close() error {
+	s.access.flushNow()
+	s.storeProofStmt.Close()
+	s.getProofStmt.Close()
+	s.logRateLimitStmt.Close()
+	return s.db.Close()
+}
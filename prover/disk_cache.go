@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const proofFileExt = ".proof"
+const sidecarFileExt = ".json"
+
+// diskSidecar is the small JSON file written alongside each <key>.proof,
+// holding everything needed to reconstruct a ProofResponse.
+type diskSidecar struct {
+	PublicInputs string `json:"publicInputs"`
+}
+
+// diskTier is the second tier of ProofCache: a size-bounded on-disk copy of
+// every proof ProofCache stores, read when the memory/Redis backend misses
+// (e.g. for a proof already evicted from memory), modeled on Bazel remote-apis-sdks' local disk cache. It evicts by atime
+// rather than insertion order, so a proof that's still being hit stays on
+// disk even if it was written long ago.
+type diskTier struct {
+	dir          string
+	maxBytes     int64
+	mu           sync.Mutex
+	totalBytes   int64
+	evictedTotal int
+}
+
+// newDiskTier creates a disk tier rooted at dir and rebuilds its size
+// accounting from whatever is already on disk, so a restart doesn't forget
+// about entries written before the process exited.
+func newDiskTier(dir string, maxBytes int64) (*diskTier, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	dt := &diskTier{dir: dir, maxBytes: maxBytes}
+	if err := dt.rebuildSizeAccounting(); err != nil {
+		return nil, err
+	}
+
+	return dt, nil
+}
+
+func (dt *diskTier) rebuildSizeAccounting() error {
+	entries, err := os.ReadDir(dt.dir)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != proofFileExt {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+	}
+
+	dt.mu.Lock()
+	dt.totalBytes = total
+	dt.mu.Unlock()
+
+	return nil
+}
+
+func (dt *diskTier) proofPath(key string) string   { return filepath.Join(dt.dir, key+proofFileExt) }
+func (dt *diskTier) sidecarPath(key string) string { return filepath.Join(dt.dir, key+sidecarFileExt) }
+
+// Get loads a proof from disk and touches its atime, since some mounts use
+// noatime/relatime and won't update it for us on a plain read.
+func (dt *diskTier) Get(key string) (*ProofResponse, bool) {
+	proofBytes, err := os.ReadFile(dt.proofPath(key))
+	if err != nil {
+		return nil, false
+	}
+
+	sidecarBytes, err := os.ReadFile(dt.sidecarPath(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var sidecar diskSidecar
+	if err := json.Unmarshal(sidecarBytes, &sidecar); err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(dt.proofPath(key), now, now) // best-effort touch; eviction just falls back to the untouched atime on failure
+
+	return &ProofResponse{
+		Proof:          string(proofBytes),
+		PublicInputs:   sidecar.PublicInputs,
+		GenerationTime: 0,
+	}, true
+}
+
+// Set spills resp to disk under key, evicting the least-recently-accessed
+// entries first if that would push the tier past MaxDiskBytes.
+func (dt *diskTier) Set(key string, resp *ProofResponse) {
+	sidecarBytes, err := json.Marshal(diskSidecar{PublicInputs: resp.PublicInputs})
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Failed to encode disk cache sidecar")
+		return
+	}
+
+	proofBytes := []byte(resp.Proof)
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	// key is a deterministic hash of the request, so Set commonly rewrites
+	// an already-present entry (disk promotion, a re-Set after a refresh).
+	// Subtract its existing size first, or totalBytes drifts upward by the
+	// full new size on every rewrite and the tier starts evicting long
+	// before it actually reaches maxBytes.
+	var existingSize int64
+	if info, err := os.Stat(dt.proofPath(key)); err == nil {
+		existingSize = info.Size()
+	}
+
+	if dt.maxBytes > 0 {
+		for dt.totalBytes-existingSize+int64(len(proofBytes)) > dt.maxBytes {
+			if !dt.evictOldestLocked() {
+				break
+			}
+		}
+	}
+
+	if err := os.WriteFile(dt.proofPath(key), proofBytes, 0644); err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Failed to write proof to disk cache")
+		return
+	}
+	if err := os.WriteFile(dt.sidecarPath(key), sidecarBytes, 0644); err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Failed to write disk cache sidecar")
+		return
+	}
+
+	dt.totalBytes += int64(len(proofBytes)) - existingSize
+}
+
+// evictOldestLocked removes the proof file with the oldest atime. dt.mu
+// must be held by the caller. Returns false if there was nothing to evict.
+func (dt *diskTier) evictOldestLocked() bool {
+	entries, err := os.ReadDir(dt.dir)
+	if err != nil {
+		return false
+	}
+
+	var oldestKey string
+	var oldestSize int64
+	var oldestAtime time.Time
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != proofFileExt {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		atime := fileAtime(info)
+		if oldestKey == "" || atime.Before(oldestAtime) {
+			oldestKey = strings.TrimSuffix(entry.Name(), proofFileExt)
+			oldestSize = info.Size()
+			oldestAtime = atime
+		}
+	}
+
+	if oldestKey == "" {
+		return false
+	}
+
+	os.Remove(dt.proofPath(oldestKey))
+	os.Remove(dt.sidecarPath(oldestKey))
+	dt.totalBytes -= oldestSize
+	dt.evictedTotal++
+	diskCacheEvictionsTotal.Inc()
+
+	return true
+}
+
+// Stats returns disk tier statistics for merging into ProofCache.Stats().
+func (dt *diskTier) Stats() map[string]interface{} {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	entries, _ := os.ReadDir(dt.dir)
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == proofFileExt {
+			count++
+		}
+	}
+
+	return map[string]interface{}{
+		"disk_bytes":           dt.totalBytes,
+		"disk_entries":         count,
+		"disk_evictions_total": dt.evictedTotal,
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	hashcashHeader   = "X-Hashcash"
+	hashcashResource = "generate-proof"
+
+	defaultPowBits   = 20 // leading zero bits required of the SHA-1 digest
+	maxPowBits       = 28
+	loadedPowBits    = 24 // bits required once recent issuance reaches powLoadThreshold
+	powLoadThreshold = 50 // challenges issued in the last powLoadWindow before bumping difficulty
+	powLoadWindow    = 10 * time.Second
+
+	powChallengeTTL  = 2 * time.Minute // how long an issued challenge (and its replay entry) stays valid
+	powCleanupPeriod = time.Minute
+)
+
+// powChallenge is a challenge issued to one client IP for hashcashResource.
+type powChallenge struct {
+	bits     int
+	issuedAt time.Time
+}
+
+// powChallengeStore tracks outstanding challenges by client IP and a replay
+// cache of (resource, rand, counter) triples already redeemed, so a stamp
+// can't be reused even within its freshness window.
+type powChallengeStore struct {
+	mu         sync.Mutex
+	challenges map[string]*powChallenge // keyed by client IP
+	redeemed   map[string]time.Time     // keyed by resource|rand|counter
+	recentAt   []time.Time              // issuance timestamps within powLoadWindow, for load-based difficulty
+}
+
+func newPowChallengeStore() *powChallengeStore {
+	s := &powChallengeStore{
+		challenges: make(map[string]*powChallenge),
+		redeemed:   make(map[string]time.Time),
+	}
+	go s.cleanup()
+	return s
+}
+
+// currentBits returns the difficulty to hand out right now, scaled up once
+// recent challenge issuance crosses powLoadThreshold.
+func (s *powChallengeStore) currentBits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-powLoadWindow)
+	kept := s.recentAt[:0]
+	for _, t := range s.recentAt {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.recentAt = kept
+
+	if len(s.recentAt) >= powLoadThreshold {
+		return loadedPowBits
+	}
+	return defaultPowBits
+}
+
+func (s *powChallengeStore) issue(clientIP string) *powChallenge {
+	bits := s.currentBits()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := &powChallenge{bits: bits, issuedAt: time.Now()}
+	s.challenges[clientIP] = c
+	s.recentAt = append(s.recentAt, c.issuedAt)
+
+	return c
+}
+
+// redeem consumes the outstanding challenge for clientIP if stampKey hasn't
+// been seen before, returning false if there's no outstanding challenge or
+// the stamp is a replay.
+func (s *powChallengeStore) redeem(clientIP, stampKey string) (*powChallenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.challenges[clientIP]
+	if !ok {
+		return nil, false
+	}
+	if _, seen := s.redeemed[stampKey]; seen {
+		return nil, false
+	}
+
+	delete(s.challenges, clientIP)
+	s.redeemed[stampKey] = time.Now()
+
+	return c, true
+}
+
+func (s *powChallengeStore) cleanup() {
+	ticker := time.NewTicker(powCleanupPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-powChallengeTTL)
+
+		s.mu.Lock()
+		for ip, c := range s.challenges {
+			if c.issuedAt.Before(cutoff) {
+				delete(s.challenges, ip)
+			}
+		}
+		for key, at := range s.redeemed {
+			if at.Before(cutoff) {
+				delete(s.redeemed, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+var powStore = newPowChallengeStore()
+
+// newChallengeHandler issues a hashcash challenge for hashcashResource,
+// scoped to the caller's IP, to be solved and replayed via the X-Hashcash
+// header on a subsequent /generate-proof request.
+func newChallengeHandler(c *gin.Context) {
+	challenge := powStore.issue(c.ClientIP())
+	powChallengesIssuedTotal.Inc()
+
+	c.JSON(http.StatusOK, gin.H{
+		"resource":  hashcashResource,
+		"timestamp": challenge.issuedAt.Unix(),
+		"bits":      challenge.bits,
+		"nonce":     randomHex(8),
+	})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// proofOfWorkMiddleware requires a valid, unreplayed X-Hashcash stamp for
+// the outstanding challenge issued to the caller's IP before letting the
+// request through to the expensive proof generation handler. This makes an
+// unauthenticated client burn CPU solving the stamp before the server
+// spends seconds on Groth16 proving.
+func proofOfWorkMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stamp := c.GetHeader(hashcashHeader)
+		if stamp == "" {
+			rejectChallenge(c, "missing_header")
+			return
+		}
+
+		parsed, err := parseHashcashStamp(stamp)
+		if err != nil {
+			rejectChallenge(c, "malformed_stamp")
+			return
+		}
+
+		if parsed.resource != hashcashResource {
+			rejectChallenge(c, "resource_mismatch")
+			return
+		}
+
+		if time.Since(parsed.timestamp) > powChallengeTTL || parsed.timestamp.After(time.Now().Add(time.Minute)) {
+			rejectChallenge(c, "stale_timestamp")
+			return
+		}
+
+		challenge, ok := powStore.redeem(c.ClientIP(), parsed.replayKey())
+		if !ok {
+			rejectChallenge(c, "unknown_or_replayed_challenge")
+			return
+		}
+
+		if challenge.bits > parsed.bits {
+			rejectChallenge(c, "insufficient_bits")
+			return
+		}
+
+		if !leadingZeroBits(sha1.Sum([]byte(stamp)), parsed.bits) {
+			rejectChallenge(c, "invalid_digest")
+			return
+		}
+
+		powChallengesSolvedTotal.Inc()
+		c.Next()
+	}
+}
+
+// rejectChallenge responds with 402 Payment Required (the conventional
+// hashcash status) alongside a fresh challenge so the client can retry
+// immediately instead of making a second round trip to /api/new-challenge.
+func rejectChallenge(c *gin.Context, reason string) {
+	powChallengesRejectedTotal.WithLabelValues(reason).Inc()
+
+	challenge := powStore.issue(c.ClientIP())
+	powChallengesIssuedTotal.Inc()
+
+	c.JSON(http.StatusPaymentRequired, gin.H{
+		"error":  "proof-of-work required",
+		"reason": reason,
+		"challenge": gin.H{
+			"resource":  hashcashResource,
+			"timestamp": challenge.issuedAt.Unix(),
+			"bits":      challenge.bits,
+			"nonce":     randomHex(8),
+		},
+	})
+	c.Abort()
+}
+
+// hashcashStamp is a parsed X-Hashcash header:
+// <version>:<bits>:<yymmddhhmm>:<resource>:<ext>:<rand>:<counter>
+type hashcashStamp struct {
+	bits      int
+	timestamp time.Time
+	resource  string
+	rand      string
+	counter   string
+}
+
+func (h hashcashStamp) replayKey() string {
+	return h.resource + "|" + h.rand + "|" + h.counter
+}
+
+func parseHashcashStamp(stamp string) (hashcashStamp, error) {
+	parts := strings.Split(stamp, ":")
+	if len(parts) != 7 {
+		return hashcashStamp{}, fmt.Errorf("expected 7 colon-separated fields, got %d", len(parts))
+	}
+
+	bits, err := strconv.Atoi(parts[1])
+	if err != nil || bits < 0 || bits > maxPowBits {
+		return hashcashStamp{}, fmt.Errorf("invalid bits field %q", parts[1])
+	}
+
+	ts, err := time.Parse("0601021504", parts[2])
+	if err != nil {
+		return hashcashStamp{}, fmt.Errorf("invalid timestamp field %q: %w", parts[2], err)
+	}
+
+	return hashcashStamp{
+		bits:      bits,
+		timestamp: ts,
+		resource:  parts[3],
+		rand:      parts[5],
+		counter:   parts[6],
+	}, nil
+}
+
+// leadingZeroBits reports whether digest has at least bits leading zero
+// bits.
+func leadingZeroBits(digest [sha1.Size]byte, bits int) bool {
+	fullBytes := bits / 8
+	remBits := bits % 8
+
+	for i := 0; i < fullBytes; i++ {
+		if digest[i] != 0 {
+			return false
+		}
+	}
+
+	if remBits == 0 {
+		return true
+	}
+
+	mask := byte(0xFF << (8 - remBits))
+	return digest[fullBytes]&mask == 0
+}
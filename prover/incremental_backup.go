@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultFullBackupEvery = 7
+	fallbackPageSize       = 4096 // SQLite's default page size, used if the header can't be read
+)
+
+// ManifestEntry records one backup in a chain: either a full snapshot or an
+// incremental delta against the previous entry.
+type ManifestEntry struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Type       string    `json:"type"` // "full" or "incremental"
+	File       string    `json:"file"`
+	PageSize   int       `json:"pageSize"`
+	PageCount  int       `json:"pageCount"`
+	PageHashes []string  `json:"pageHashes"` // sha256 hex per page, used to diff the next incremental
+}
+
+// BackupManifest is the per-chain ledger of full + incremental backups,
+// stored under a "chain_<chainID>_manifest.json" key in the BackupStore.
+type BackupManifest struct {
+	ChainID         string          `json:"chainId"`
+	FullBackupEvery int             `json:"fullBackupEvery"`
+	Entries         []ManifestEntry `json:"entries"`
+}
+
+const chainRegistryName = "chain_registry.json"
+
+func manifestName(chainID string) string        { return "chain_" + chainID + "_manifest.json" }
+func chainFileName(chainID, file string) string { return "chain_" + chainID + "_" + file }
+
+func (bm *BackupManager) loadManifest(ctx context.Context, chainID string) (*BackupManifest, error) {
+	rc, err := bm.store.Get(ctx, manifestName(chainID))
+	if err != nil {
+		return &BackupManifest{ChainID: chainID, FullBackupEvery: bm.fullBackupEvery()}, nil
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+func (bm *BackupManager) saveManifest(ctx context.Context, manifest *BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	return bm.store.Put(ctx, manifestName(manifest.ChainID), bytes.NewReader(data), int64(len(data)))
+}
+
+// loadChainRegistry returns the list of chain IDs that have ever taken an
+// incremental backup. The registry exists because BackupStore.List only
+// enumerates ".db" blobs: it sees a chain's full snapshots but not its
+// manifest or ".delta" files, so chains can't be discovered from it.
+func (bm *BackupManager) loadChainRegistry(ctx context.Context) ([]string, error) {
+	rc, err := bm.store.Get(ctx, chainRegistryName)
+	if err != nil {
+		return nil, nil
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chain registry: %w", err)
+	}
+
+	var chainIDs []string
+	if err := json.Unmarshal(data, &chainIDs); err != nil {
+		return nil, fmt.Errorf("failed to parse chain registry: %w", err)
+	}
+	return chainIDs, nil
+}
+
+func (bm *BackupManager) registerChain(ctx context.Context, chainID string) error {
+	chainIDs, err := bm.loadChainRegistry(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range chainIDs {
+		if id == chainID {
+			return nil
+		}
+	}
+	chainIDs = append(chainIDs, chainID)
+
+	data, err := json.Marshal(chainIDs)
+	if err != nil {
+		return fmt.Errorf("failed to encode chain registry: %w", err)
+	}
+	return bm.store.Put(ctx, chainRegistryName, bytes.NewReader(data), int64(len(data)))
+}
+
+func (bm *BackupManager) fullBackupEvery() int {
+	if bm.FullBackupEvery <= 0 {
+		return defaultFullBackupEvery
+	}
+	return bm.FullBackupEvery
+}
+
+// BackupIncremental takes the next backup in chainID: a full snapshot if the
+// chain is empty or has grown to FullBackupEvery incrementals since the last
+// full backup, otherwise a page-level delta against the previous entry.
+func (bm *BackupManager) BackupIncremental(dbPath, chainID string) (err error) {
+	start := time.Now()
+	defer func() {
+		backupDurationSeconds.Observe(time.Since(start).Seconds())
+		if err != nil {
+			backupFailuresTotal.Inc()
+		}
+	}()
+
+	ctx := context.Background()
+
+	manifest, err := bm.loadManifest(ctx, chainID)
+	if err != nil {
+		return fmt.Errorf("failed to load backup chain manifest: %w", err)
+	}
+
+	snapshotPath := filepath.Join(bm.stagingDir, fmt.Sprintf("%s_snapshot_%d.db", chainID, time.Now().UnixNano()))
+	if _, err := bm.backupViaSQLiteAPI(dbPath, snapshotPath); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	defer os.Remove(snapshotPath)
+
+	pageSize, hashes, snapshot, err := pageHashesOf(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash database pages: %w", err)
+	}
+
+	sinceLastFull := incrementalsSinceLastFull(manifest)
+	takeFull := len(manifest.Entries) == 0 || sinceLastFull >= bm.fullBackupEvery()
+
+	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	var entry ManifestEntry
+
+	if takeFull {
+		file := fmt.Sprintf("proofs_full_%s.db", timestamp)
+		if err := bm.store.Put(ctx, chainFileName(chainID, file), bytes.NewReader(snapshot), int64(len(snapshot))); err != nil {
+			return fmt.Errorf("failed to upload full backup: %w", err)
+		}
+		entry = ManifestEntry{Timestamp: time.Now(), Type: "full", File: file, PageSize: pageSize, PageCount: len(hashes), PageHashes: hashes}
+		backupPagesCopied.Add(float64(len(hashes)))
+	} else {
+		prev := manifest.Entries[len(manifest.Entries)-1]
+		changed := diffPages(prev.PageHashes, hashes)
+
+		deltaBytes, err := buildDeltaFile(pageSize, len(hashes), changed, snapshot)
+		if err != nil {
+			return fmt.Errorf("failed to build delta: %w", err)
+		}
+
+		file := fmt.Sprintf("proofs_incr_%s.delta", timestamp)
+		if err := bm.store.Put(ctx, chainFileName(chainID, file), bytes.NewReader(deltaBytes), int64(len(deltaBytes))); err != nil {
+			return fmt.Errorf("failed to upload incremental backup: %w", err)
+		}
+		entry = ManifestEntry{Timestamp: time.Now(), Type: "incremental", File: file, PageSize: pageSize, PageCount: len(hashes), PageHashes: hashes}
+		backupPagesCopied.Add(float64(len(changed)))
+	}
+
+	manifest.FullBackupEvery = bm.fullBackupEvery()
+	manifest.Entries = append(manifest.Entries, entry)
+	if err := bm.saveManifest(ctx, manifest); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	if err := bm.registerChain(ctx, chainID); err != nil {
+		return fmt.Errorf("failed to update chain registry: %w", err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"chain_id": chainID,
+		"type":     entry.Type,
+		"file":     entry.File,
+		"duration": time.Since(start),
+	}).Info("Incremental backup chain updated")
+
+	return nil
+}
+
+func incrementalsSinceLastFull(manifest *BackupManifest) int {
+	count := 0
+	for i := len(manifest.Entries) - 1; i >= 0; i-- {
+		if manifest.Entries[i].Type == "full" {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+// pageHashesOf splits path into fixed-size SQLite pages (reading the actual
+// page size from the database header at offset 16 when possible) and
+// returns a sha256 hash per page, alongside the raw file contents.
+func pageHashesOf(path string) (pageSize int, hashes []string, data []byte, err error) {
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	pageSize = fallbackPageSize
+	if len(data) >= 18 {
+		if hdr := binary.BigEndian.Uint16(data[16:18]); hdr >= 512 {
+			pageSize = int(hdr)
+		}
+	}
+
+	hashes = make([]string, 0, len(data)/pageSize+1)
+	for off := 0; off < len(data); off += pageSize {
+		end := off + pageSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[off:end])
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+
+	return pageSize, hashes, data, nil
+}
+
+// diffPages returns the indices of pages that are new or changed in
+// newHashes relative to oldHashes.
+func diffPages(oldHashes, newHashes []string) []int {
+	var changed []int
+	for i, h := range newHashes {
+		if i >= len(oldHashes) || oldHashes[i] != h {
+			changed = append(changed, i)
+		}
+	}
+	return changed
+}
+
+// buildDeltaFile encodes a gzip-compressed page delta: a small header
+// (page size, total page count, number of changed pages) followed by each
+// changed page's index and raw bytes.
+func buildDeltaFile(pageSize, pageCount int, changed []int, data []byte) ([]byte, error) {
+	var raw bytes.Buffer
+	header := struct {
+		PageSize  int32
+		PageCount int32
+		NumPages  int32
+	}{int32(pageSize), int32(pageCount), int32(len(changed))}
+
+	if err := binary.Write(&raw, binary.BigEndian, header); err != nil {
+		return nil, err
+	}
+
+	for _, idx := range changed {
+		off := idx * pageSize
+		end := off + pageSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := binary.Write(&raw, binary.BigEndian, int32(idx)); err != nil {
+			return nil, err
+		}
+		page := make([]byte, pageSize)
+		copy(page, data[off:end])
+		if _, err := raw.Write(page); err != nil {
+			return nil, err
+		}
+	}
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	if _, err := gw.Write(raw.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return compressed.Bytes(), nil
+}
+
+// applyDeltaFile decodes a delta produced by buildDeltaFile and overlays its
+// changed pages onto base, growing or truncating base to the delta's page
+// count first.
+func applyDeltaFile(base []byte, deltaGz []byte) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(deltaGz))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open delta: %w", err)
+	}
+	defer gr.Close()
+
+	var header struct {
+		PageSize  int32
+		PageCount int32
+		NumPages  int32
+	}
+	if err := binary.Read(gr, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read delta header: %w", err)
+	}
+
+	pageSize := int(header.PageSize)
+	total := make([]byte, int(header.PageCount)*pageSize)
+	copy(total, base)
+
+	for i := int32(0); i < header.NumPages; i++ {
+		var idx int32
+		if err := binary.Read(gr, binary.BigEndian, &idx); err != nil {
+			return nil, fmt.Errorf("failed to read delta page index: %w", err)
+		}
+		page := make([]byte, pageSize)
+		if _, err := io.ReadFull(gr, page); err != nil {
+			return nil, fmt.Errorf("failed to read delta page: %w", err)
+		}
+		copy(total[int(idx)*pageSize:], page)
+	}
+
+	return total, nil
+}
+
+// RestoreChainAt reconstructs chainID's database as of targetTS by applying
+// the most recent full backup at or before targetTS and replaying
+// incremental deltas up to targetTS, then writes the result to targetPath.
+func (bm *BackupManager) RestoreChainAt(chainID string, targetTS time.Time, targetPath string) error {
+	ctx := context.Background()
+
+	manifest, err := bm.loadManifest(ctx, chainID)
+	if err != nil {
+		return fmt.Errorf("failed to load backup chain manifest: %w", err)
+	}
+
+	fullIdx := -1
+	for i, e := range manifest.Entries {
+		if e.Type == "full" && !e.Timestamp.After(targetTS) {
+			fullIdx = i
+		}
+	}
+	if fullIdx == -1 {
+		return fmt.Errorf("no full backup at or before %s in chain %q", targetTS, chainID)
+	}
+
+	data, err := bm.fetchChainFile(ctx, chainID, manifest.Entries[fullIdx].File)
+	if err != nil {
+		return fmt.Errorf("failed to fetch full backup: %w", err)
+	}
+
+	for i := fullIdx + 1; i < len(manifest.Entries); i++ {
+		entry := manifest.Entries[i]
+		if entry.Timestamp.After(targetTS) {
+			break
+		}
+		if entry.Type != "incremental" {
+			break
+		}
+
+		delta, err := bm.fetchChainFile(ctx, chainID, entry.File)
+		if err != nil {
+			return fmt.Errorf("failed to fetch incremental backup %q: %w", entry.File, err)
+		}
+
+		data, err = applyDeltaFile(data, delta)
+		if err != nil {
+			return fmt.Errorf("failed to apply incremental backup %q: %w", entry.File, err)
+		}
+	}
+
+	if err := os.WriteFile(targetPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write restored database: %w", err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"chain_id":    chainID,
+		"target_time": targetTS,
+		"target_path": targetPath,
+	}).Info("Point-in-time restore completed")
+
+	return nil
+}
+
+func (bm *BackupManager) fetchChainFile(ctx context.Context, chainID, file string) ([]byte, error) {
+	rc, err := bm.store.Get(ctx, chainFileName(chainID, file))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// ListChains returns the manifest for every incremental backup chain that
+// has ever been written via BackupIncremental.
+func (bm *BackupManager) ListChains() ([]*BackupManifest, error) {
+	ctx := context.Background()
+
+	chainIDs, err := bm.loadChainRegistry(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup chains: %w", err)
+	}
+
+	manifests := make([]*BackupManifest, 0, len(chainIDs))
+	for _, chainID := range chainIDs {
+		manifest, err := bm.loadManifest(ctx, chainID)
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	return manifests, nil
+}
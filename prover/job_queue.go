@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Job statuses, in the order a job moves through them.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is one asynchronously-processed /generate-proof request.
+type Job struct {
+	ID          string         `json:"id"`
+	Status      string         `json:"status"`
+	Request     *ProofRequest  `json:"request"`
+	Result      *ProofResponse `json:"result,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	CallbackURL string         `json:"callbackUrl,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+// JobStore persists job state. Implementations must be safe for concurrent
+// use, since the worker pool and HTTP handlers access the same job
+// concurrently.
+type JobStore interface {
+	Create(job *Job) error
+	Get(id string) (*Job, bool)
+	Update(job *Job) error
+}
+
+// memoryJobStore is a process-local JobStore, the default when no
+// JOB_STORE_* environment variable selects a shared backend.
+type memoryJobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{jobs: make(map[string]*Job)}
+}
+
+// Create, Get, and Update copy the Job so a caller mutating its *Job never
+// races with another goroutine reading the stored one.
+func (s *memoryJobStore) Create(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *job
+	s.jobs[job.ID] = &cp
+	return nil
+}
+
+func (s *memoryJobStore) Get(id string) (*Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *job
+	return &cp, true
+}
+
+func (s *memoryJobStore) Update(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp := *job
+	s.jobs[job.ID] = &cp
+	return nil
+}
+
+// jobsBucket is the single bbolt bucket jobs are stored in, keyed by job ID.
+var jobsBucket = []byte("jobs")
+
+// boltJobStore is a JobStore backed by an embedded BoltDB file, so job state
+// survives a process restart without standing up Redis.
+type boltJobStore struct {
+	db *bolt.DB
+}
+
+func newBoltJobStore(path string) (*boltJobStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt job store: %w", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create bolt jobs bucket: %w", err)
+	}
+
+	return &boltJobStore{db: db}, nil
+}
+
+func (s *boltJobStore) Create(job *Job) error {
+	return s.Update(job)
+}
+
+func (s *boltJobStore) Get(id string) (*Job, bool) {
+	var job Job
+	found := false
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &job)
+	})
+	if err != nil || !found {
+		return nil, false
+	}
+
+	return &job, true
+}
+
+func (s *boltJobStore) Update(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+}
+
+// redisJobKeyPrefix namespaces job keys in a shared Redis instance.
+const redisJobKeyPrefix = "prover:job:"
+
+// redisJobStore is a JobStore backed by Redis, so a horizontally-scaled
+// prover fleet shares job state: a job enqueued on one replica can be polled
+// or long-polled from another.
+type redisJobStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func newRedisJobStore(addr string, ttl time.Duration) *redisJobStore {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+	return &redisJobStore{client: client, ttl: ttl}
+}
+
+func (s *redisJobStore) Create(job *Job) error {
+	return s.Update(job)
+}
+
+func (s *redisJobStore) Get(id string) (*Job, bool) {
+	data, err := s.client.Get(context.Background(), redisJobKeyPrefix+id).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Failed to decode job from Redis")
+		return nil, false
+	}
+
+	return &job, true
+}
+
+func (s *redisJobStore) Update(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	return s.client.Set(context.Background(), redisJobKeyPrefix+job.ID, data, s.ttl).Err()
+}
+
+// JobQueue runs submitted proof requests on a bounded worker pool and
+// records their progress in a JobStore, so /generate-proof can offload
+// expensive proving off the request goroutine when the caller sends
+// "Prefer: respond-async".
+type JobQueue struct {
+	store   JobStore
+	queue   chan string
+	workers int
+}
+
+// NewJobQueueFromEnv builds a JobQueue sized by JOB_QUEUE_WORKERS (default
+// GOMAXPROCS) and backed by the store selected by JOB_STORE_BACKEND:
+// "bolt" (JOB_STORE_PATH, default "./jobs.db"), "redis" (JOB_STORE_REDIS_ADDR),
+// or the in-memory store if unset.
+func NewJobQueueFromEnv() (*JobQueue, error) {
+	workers := runtime.GOMAXPROCS(0)
+	if v := os.Getenv("JOB_QUEUE_WORKERS"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			workers = parsed
+		}
+	}
+
+	var store JobStore
+	switch os.Getenv("JOB_STORE_BACKEND") {
+	case "bolt":
+		path := os.Getenv("JOB_STORE_PATH")
+		if path == "" {
+			path = "./jobs.db"
+		}
+		boltStore, err := newBoltJobStore(path)
+		if err != nil {
+			return nil, err
+		}
+		store = boltStore
+	case "redis":
+		addr := os.Getenv("JOB_STORE_REDIS_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("JOB_STORE_BACKEND=redis requires JOB_STORE_REDIS_ADDR")
+		}
+		store = newRedisJobStore(addr, 24*time.Hour)
+	default:
+		store = newMemoryJobStore()
+	}
+
+	return &JobQueue{
+		store:   store,
+		queue:   make(chan string, 1024),
+		workers: workers,
+	}, nil
+}
+
+// Enqueue records req as a new pending job and schedules it for processing.
+// It returns without waiting for the proof, but blocks while the queue's
+// 1024-entry buffer is full.
+func (jq *JobQueue) Enqueue(req *ProofRequest, callbackURL string) *Job {
+	now := time.Now()
+	job := &Job{
+		ID:          uuid.NewString(),
+		Status:      JobPending,
+		Request:     req,
+		CallbackURL: callbackURL,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	jq.store.Create(job)
+	jobQueueDepth.Inc()
+	jobsByStatusTotal.WithLabelValues(JobPending).Inc()
+
+	jq.queue <- job.ID
+	return job
+}
+
+// Get returns the job with the given ID, if known to this queue's store.
+func (jq *JobQueue) Get(id string) (*Job, bool) {
+	return jq.store.Get(id)
+}
+
+// Start launches the worker pool. It must be called once, after the queue
+// is constructed and before any job is enqueued.
+func (jq *JobQueue) Start() {
+	for i := 0; i < jq.workers; i++ {
+		go jq.worker()
+	}
+}
+
+func (jq *JobQueue) worker() {
+	for id := range jq.queue {
+		jq.process(id)
+	}
+}
+
+func (jq *JobQueue) process(id string) {
+	job, ok := jq.store.Get(id)
+	if !ok {
+		return
+	}
+
+	jobQueueDepth.Dec()
+	jobWorkersActive.Inc()
+	defer jobWorkersActive.Dec()
+
+	job.Status = JobRunning
+	job.UpdatedAt = time.Now()
+	jq.store.Update(job)
+
+	// GetOrGenerate coalesces against any identical request already being
+	// proved - by another worker, or by the synchronous handler - instead
+	// of always running the pipeline fresh.
+	response, _, err := proofCache.GetOrGenerate(job.Request, func() (*ProofResponse, error) {
+		return generateProof(job.Request)
+	})
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		job.UpdatedAt = time.Now()
+		jq.store.Update(job)
+		jobsByStatusTotal.WithLabelValues(JobFailed).Inc()
+		return
+	}
+
+	if proofJwt, err := signProofResponse(response); err != nil {
+		log.Printf("Failed to sign proof envelope for job %s: %v", job.ID, err)
+	} else {
+		response.ProofJwt = proofJwt
+	}
+
+	job.Status = JobDone
+	job.Result = response
+	job.UpdatedAt = time.Now()
+	jq.store.Update(job)
+	jobsByStatusTotal.WithLabelValues(JobDone).Inc()
+
+	if job.CallbackURL != "" {
+		jq.deliverCallback(job)
+	}
+}
+
+// deliverCallback POSTs the finished job's signed ProofResponse to its
+// CallbackURL. Delivery is best-effort: a failed callback doesn't change the
+// job's status, since the result is still available via GET /jobs/:id.
+func (jq *JobQueue) deliverCallback(job *Job) {
+	body, err := json.Marshal(job.Result)
+	if err != nil {
+		log.Printf("Failed to encode callback payload for job %s: %v", job.ID, err)
+		return
+	}
+
+	resp, err := http.Post(job.CallbackURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Callback delivery failed for job %s: %v", job.ID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("Callback for job %s returned status %d", job.ID, resp.StatusCode)
+	}
+}
+
+// jobStatusHandler serves GET /jobs/:id.
+func jobStatusHandler(c *gin.Context) {
+	job, ok := jobQueue.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// defaultJobWaitTimeout bounds how long jobWaitHandler will long-poll when
+// the caller's "timeout" query parameter is absent or invalid.
+const (
+	defaultJobWaitTimeout = 30 * time.Second
+	maxJobWaitTimeout     = 2 * time.Minute
+	jobWaitPollInterval   = 250 * time.Millisecond
+)
+
+// jobWaitHandler serves GET /jobs/:id/wait?timeout=30s, long-polling the
+// JobStore until the job reaches a terminal status or timeout elapses,
+// whichever comes first.
+func jobWaitHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	timeout := defaultJobWaitTimeout
+	if raw := c.Query("timeout"); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			timeout = parsed
+		}
+	}
+	if timeout > maxJobWaitTimeout {
+		timeout = maxJobWaitTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(jobWaitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, ok := jobQueue.Get(id)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		if job.Status == JobDone || job.Status == JobFailed {
+			c.JSON(http.StatusOK, job)
+			return
+		}
+
+		if time.Now().After(deadline) {
+			c.JSON(http.StatusOK, job)
+			return
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	jwksDefaultRefresh = 5 * time.Minute
+	jwtClockSkew       = 2 * time.Minute
+)
+
+// jwk is the subset of RFC 7517 fields this prover understands: RSA (kty
+// "RSA"), EC (kty "EC"), and OKP/Ed25519 (kty "OKP") public keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+func b64url(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func unb64url(s string) ([]byte, error) { return base64.RawURLEncoding.DecodeString(s) }
+
+// toPublicKey converts a jwk into the crypto key type golang-jwt expects
+// for verification.
+func (k jwk) toPublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		nBytes, err := unb64url(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		eBytes, err := unb64url(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}, nil
+
+	case "EC":
+		xBytes, err := unb64url(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		yBytes, err := unb64url(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(xBytes),
+			Y:     new(big.Int).SetBytes(yBytes),
+		}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+		xBytes, err := unb64url(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 public key: %w", err)
+		}
+		return ed25519.PublicKey(xBytes), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// jwksCache fetches and caches a remote JWKS by kid, refreshing in the
+// background on the issuer's Cache-Control max-age (jwksDefaultRefresh when
+// absent) and revalidating with ETag, so a rotating key is picked up.
+// Looking up a cached kid never touches the network; an unknown kid
+// triggers one synchronous refresh (see key).
+type jwksCache struct {
+	url string
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	etag        string
+	nextRefresh time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	c := &jwksCache{url: url, keys: make(map[string]interface{})}
+	if err := c.refresh(); err != nil {
+		log.WithFields(logrus.Fields{"error": err.Error()}).Warn("Initial JWKS fetch failed, will retry in background")
+	}
+	go c.refreshLoop()
+	return c
+}
+
+func (c *jwksCache) refreshLoop() {
+	for {
+		c.mu.RLock()
+		wait := time.Until(c.nextRefresh)
+		c.mu.RUnlock()
+		if wait <= 0 {
+			wait = jwksDefaultRefresh
+		}
+		time.Sleep(wait)
+
+		if err := c.refresh(); err != nil {
+			log.WithFields(logrus.Fields{"error": err.Error()}).Warn("JWKS refresh failed")
+		}
+	}
+}
+
+// refresh re-fetches the JWKS, sending If-None-Match when we have a cached
+// ETag so an unchanged key set costs the issuer a 304 instead of a body.
+func (c *jwksCache) refresh() error {
+	req, err := http.NewRequest(http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	etag := c.etag
+	c.mu.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	refreshIn := jwksDefaultRefresh
+	if cc := resp.Header.Get("Cache-Control"); cc != "" {
+		if maxAge, ok := parseMaxAge(cc); ok {
+			refreshIn = time.Duration(maxAge) * time.Second
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		c.mu.Lock()
+		c.nextRefresh = time.Now().Add(refreshIn)
+		c.mu.Unlock()
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d fetching JWKS", resp.StatusCode)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		pub, err := k.toPublicKey()
+		if err != nil {
+			log.WithFields(logrus.Fields{"kid": k.Kid, "error": err.Error()}).Warn("Skipping unparseable JWKS entry")
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.etag = resp.Header.Get("ETag")
+	c.nextRefresh = time.Now().Add(refreshIn)
+	c.mu.Unlock()
+
+	return nil
+}
+
+func parseMaxAge(cacheControl string) (int, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(directive, "max-age=") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// key returns the public key for kid, forcing a synchronous refresh first
+// if it isn't cached yet (e.g. a newly rotated-in signing key).
+func (c *jwksCache) key(kid string) (interface{}, error) {
+	c.mu.RLock()
+	pub, ok := c.keys[kid]
+	c.mu.RUnlock()
+	if ok {
+		return pub, nil
+	}
+
+	if err := c.refresh(); err != nil {
+		return nil, fmt.Errorf("kid %q not cached and refresh failed: %w", kid, err)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	pub, ok = c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("kid %q not found in JWKS", kid)
+	}
+	return pub, nil
+}
+
+var remoteJWKS *jwksCache
+
+func jwtAuthEnabled() bool { return os.Getenv("JWKS_URL") != "" }
+
+// jwtClaims is the set of registered + custom claims this prover checks.
+type jwtClaims struct {
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// jwtAuthMiddleware validates the Authorization: Bearer token against the
+// configured JWKS, replacing the static API_KEY check when JWKS_URL is set.
+// The verified subject is stored under identityContextKey so
+// rateLimitMiddleware buckets per-subject instead of per-IP.
+func jwtAuthMiddleware() gin.HandlerFunc {
+	if remoteJWKS == nil {
+		remoteJWKS = newJWKSCache(os.Getenv("JWKS_URL"))
+	}
+
+	issuer := os.Getenv("JWT_ISSUER")
+	audience := os.Getenv("JWT_AUDIENCE")
+	requiredScope := os.Getenv("JWT_REQUIRED_SCOPE")
+
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing or malformed Authorization header"})
+			c.Abort()
+			return
+		}
+
+		var claims jwtClaims
+		parserOpts := []jwt.ParserOption{
+			jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+			jwt.WithLeeway(jwtClockSkew),
+		}
+		if issuer != "" {
+			parserOpts = append(parserOpts, jwt.WithIssuer(issuer))
+		}
+		if audience != "" {
+			parserOpts = append(parserOpts, jwt.WithAudience(audience))
+		}
+
+		token, err := jwt.ParseWithClaims(parts[1], &claims, func(t *jwt.Token) (interface{}, error) {
+			kid, ok := t.Header["kid"].(string)
+			if !ok || kid == "" {
+				return nil, fmt.Errorf("token header missing kid")
+			}
+			return remoteJWKS.key(kid)
+		}, parserOpts...)
+
+		if err != nil || !token.Valid {
+			log.WithFields(logrus.Fields{
+				"client_ip": c.ClientIP(),
+				"error":     err,
+			}).Warn("JWT verification failed")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			c.Abort()
+			return
+		}
+
+		if requiredScope != "" && c.FullPath() == "/generate-proof" && !hasScope(claims.Scope, requiredScope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("token missing required scope %q", requiredScope)})
+			c.Abort()
+			return
+		}
+
+		c.Set(identityContextKey, claims.Subject)
+		c.Next()
+	}
+}
+
+func hasScope(scopeClaim, required string) bool {
+	for _, s := range strings.Fields(scopeClaim) {
+		if s == required {
+			return true
+		}
+	}
+	return false
+}
+
+// localSigningKey is generated once per process start and used to sign the
+// proofJwt envelope and to serve /.well-known/jwks.json. It's intentionally
+// not persisted: restarting the process simply rotates it, and
+// verifiers are expected to fetch the current key from the JWKS endpoint
+// rather than pin it.
+var (
+	localSigningKey ed25519.PublicKey
+	localPrivateKey ed25519.PrivateKey
+	localKeyID      string
+)
+
+func init() {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate local JWT signing key: %v", err))
+	}
+	localSigningKey = pub
+	localPrivateKey = priv
+	sum := sha256.Sum256(pub)
+	localKeyID = hex.EncodeToString(sum[:8])
+}
+
+// jwksHandler serves this prover's own signing key as a JWKS, so
+// downstream verifiers of proofJwt can validate it without a shared secret.
+func jwksHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, jwkSet{
+		Keys: []jwk{{
+			Kty: "OKP",
+			Kid: localKeyID,
+			Alg: "EdDSA",
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   b64url(localSigningKey),
+		}},
+	})
+}
+
+// proofEnvelopeClaims binds a generated proof's hash and public inputs to a
+// signing timestamp, so a verifier holding proofJwt can be sure this prover
+// vouches for exactly that proof at exactly that time.
+type proofEnvelopeClaims struct {
+	ProofSHA256  string   `json:"proofSha256"`
+	PublicInputs []string `json:"publicInputs"`
+	jwt.RegisteredClaims
+}
+
+// signProofResponse signs a JWT binding resp's proof bytes and public
+// inputs to the current time, for clients that want a verifiable envelope
+// around the raw Groth16 proof.
+func signProofResponse(resp *ProofResponse) (string, error) {
+	digest := sha256.Sum256([]byte(resp.Proof))
+
+	claims := proofEnvelopeClaims{
+		ProofSHA256:  hex.EncodeToString(digest[:]),
+		PublicInputs: resp.PublicInputs,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+			Issuer:   "umbra-prover",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = localKeyID
+
+	return token.SignedString(localPrivateKey)
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/big"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/consensys/gnark-crypto/ecc"
@@ -31,15 +35,15 @@ type PaymentCircuit struct {
 	CurrentTime   frontend.Variable `gnark:",public"`
 
 	// Private inputs
-	ActualAmount  frontend.Variable
-	SenderKeyX    frontend.Variable
-	SenderKeyY    frontend.Variable
-	PaymentTime   frontend.Variable
+	ActualAmount frontend.Variable
+	SenderKeyX   frontend.Variable
+	SenderKeyY   frontend.Variable
+	PaymentTime  frontend.Variable
 
 	// EdDSA signature components
-	SignatureR8X  frontend.Variable
-	SignatureR8Y  frontend.Variable
-	SignatureS    frontend.Variable
+	SignatureR8X frontend.Variable
+	SignatureR8Y frontend.Variable
+	SignatureS   frontend.Variable
 }
 
 // Define declares the circuit constraints
@@ -103,15 +107,15 @@ type ProofRequest struct {
 	CurrentTime   int64  `json:"currentTime"`
 
 	// Private inputs
-	ActualAmount  string `json:"actualAmount"`
-	SenderKeyX    string `json:"senderKeyX"`
-	SenderKeyY    string `json:"senderKeyY"`
-	PaymentTime   int64  `json:"paymentTime"`
+	ActualAmount string `json:"actualAmount"`
+	SenderKeyX   string `json:"senderKeyX"`
+	SenderKeyY   string `json:"senderKeyY"`
+	PaymentTime  int64  `json:"paymentTime"`
 
 	// EdDSA signature
-	SignatureR8X  string `json:"signatureR8x"`
-	SignatureR8Y  string `json:"signatureR8y"`
-	SignatureS    string `json:"signatureS"`
+	SignatureR8X string `json:"signatureR8x"`
+	SignatureR8Y string `json:"signatureR8y"`
+	SignatureS   string `json:"signatureS"`
 }
 
 // ProofResponse represents the generated proof
@@ -119,23 +123,45 @@ type ProofResponse struct {
 	Proof          string   `json:"proof"`
 	PublicInputs   []string `json:"publicInputs"`
 	GenerationTime int64    `json:"generationTimeMs"`
+	// ProofJwt is an EdDSA-signed envelope (see /.well-known/jwks.json)
+	// binding Proof and PublicInputs to the time this response was issued.
+	ProofJwt string `json:"proofJwt,omitempty"`
 }
 
 var (
-	provingKey   groth16.ProvingKey
-	verifyingKey groth16.VerifyingKey
-	ccs          frontend.CompiledConstraintSystem
-	rateLimiter  *RateLimiter
-	proofCache   *ProofCache
+	provingKey    groth16.ProvingKey
+	verifyingKey  groth16.VerifyingKey
+	ccs           frontend.CompiledConstraintSystem
+	rateLimiter   *RateLimiter
+	proofCache    *ProofCache
+	backupManager *BackupManager
+	jobQueue      *JobQueue
+	proofStore    ProofStore
+
+	// verifiedProvingKeySigner and verifiedVerifyingKeySigner record who
+	// signed the trusted-setup keys this binary
+	// loaded, for /health to report.
+	verifiedProvingKeySigner   *VerifiedArtifact
+	verifiedVerifyingKeySigner *VerifiedArtifact
 )
 
 const (
 	// Key file paths - these are generated from trusted setup ceremony
-	provingKeyPath    = "./keys/payment_proof.pk"
-	verifyingKeyPath  = "./keys/payment_proof.vk"
+	provingKeyPath   = "./keys/payment_proof.pk"
+	verifyingKeyPath = "./keys/payment_proof.vk"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		runBackupCLI(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "cleanup" {
+		runCleanupCLI(os.Args[2:])
+		return
+	}
+
 	log.Println("Starting Umbra Protocol prover service...")
 
 	log.Println("Compiling circuit...")
@@ -151,26 +177,114 @@ func main() {
 	proofCache = NewProofCache(1000, time.Hour)
 	log.Println("Proof cache initialized")
 
+	bm, err := NewBackupManagerFromEnv(24)
+	if err != nil {
+		log.Fatalf("Failed to initialize backup manager: %v", err)
+	}
+	backupManager = bm
+	log.Println("Backup manager initialized")
+
+	jq, err := NewJobQueueFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize job queue: %v", err)
+	}
+	jobQueue = jq
+	jobQueue.Start()
+	log.Println("Async job queue initialized")
+
+	store, err := NewProofDatabase()
+	if err != nil {
+		log.Fatalf("Failed to initialize proof database: %v", err)
+	}
+	proofStore = store
+	shutdownCleanupWorker := StartCleanupWorker(context.Background(), proofStore)
+	log.Println("Proof database initialized")
+
+	go waitForShutdownSignal(shutdownCleanupWorker, proofStore)
+
 	log.Println("Prover service ready on :8080")
 
 	// Start HTTP server
 	router := gin.Default()
 
 	// Add middlewares
+	router.Use(authMiddleware())
 	router.Use(rateLimitMiddleware())
 	router.Use(metricsMiddleware())
 
 	// Endpoints
-	router.POST("/generate-proof", generateProofHandler)
+	router.POST("/generate-proof", proofOfWorkMiddleware(), generateProofHandler)
+	router.POST("/api/new-challenge", newChallengeHandler)
 	router.GET("/health", healthHandler)
 	router.GET("/metrics", metricsHandler())
 	router.GET("/cache/stats", cacheStatsHandler)
+	router.GET("/backup/chains", listBackupChainsHandler)
+	router.POST("/backup/restore", restoreBackupChainHandler)
+	router.POST("/reload-ca", reloadCAHandler)
+	router.GET("/.well-known/jwks.json", jwksHandler)
+	router.GET("/jobs/:id", jobStatusHandler)
+	router.GET("/jobs/:id/wait", jobWaitHandler)
+
+	tlsConfig, err := buildTLSConfig()
+	if err != nil {
+		log.Fatalf("Failed to build TLS config: %v", err)
+	}
+
+	if tlsConfig != nil {
+		server := &http.Server{
+			Addr:      ":8443",
+			Handler:   router,
+			TLSConfig: tlsConfig,
+		}
+		log.Println("Serving on :8443 with TLS" + mtlsLogSuffix())
+		if err := server.ListenAndServeTLS("", ""); err != nil {
+			log.Fatalf("Failed to start TLS server: %v", err)
+		}
+		return
+	}
 
 	if err := router.Run(":8080"); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
+// shutdownTimeout bounds how long waitForShutdownSignal waits for the
+// cleanup worker to exit before closing the store out from under it anyway.
+const shutdownTimeout = 10 * time.Second
+
+// waitForShutdownSignal blocks until the process receives SIGINT or SIGTERM,
+// then stops the cleanup worker and closes store. This must happen in that
+// order - closing store while the worker's ticker fires would hand it a
+// closed *sql.DB - so the worker's shutdown func is awaited (up to
+// shutdownTimeout) before store.Close() ever runs.
+func waitForShutdownSignal(shutdownCleanupWorker func(context.Context) error, store ProofStore) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+
+	log.Println("Shutdown signal received, stopping cleanup worker...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := shutdownCleanupWorker(ctx); err != nil {
+		log.Printf("Cleanup worker did not shut down cleanly: %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		log.Printf("Failed to close proof database: %v", err)
+	}
+
+	os.Exit(0)
+}
+
+func mtlsLogSuffix() string {
+	if mtlsEnabled() {
+		return " (mutual TLS required)"
+	}
+	return ""
+}
+
 func initializeCircuit() error {
 	var circuit PaymentCircuit
 	var err error
@@ -184,6 +298,24 @@ func initializeCircuit() error {
 
 	// Try to load keys from trusted setup ceremony files
 	if keysExist() {
+		log.Println("Verifying trusted setup artifact signatures...")
+		roots, err := loadCosignRoots()
+		if err != nil {
+			return fmt.Errorf("failed to load cosign trust roots: %w", err)
+		}
+
+		pkSigner, err := verifyCeremonyArtifact(provingKeyPath, roots)
+		if err != nil {
+			return fmt.Errorf("refusing to load unverified proving key: %w", err)
+		}
+		vkSigner, err := verifyCeremonyArtifact(verifyingKeyPath, roots)
+		if err != nil {
+			return fmt.Errorf("refusing to load unverified verifying key: %w", err)
+		}
+		verifiedProvingKeySigner = pkSigner
+		verifiedVerifyingKeySigner = vkSigner
+		log.Printf("Trusted setup artifacts verified: signer=%s rekorLogIndex=%d,%d", pkSigner.SignerIdentity, pkSigner.RekorLogIndex, vkSigner.RekorLogIndex)
+
 		log.Println("Loading proving key from trusted setup...")
 		pk, err := loadProvingKey(provingKeyPath)
 		if err != nil {
@@ -293,9 +425,19 @@ func saveKeys(pk groth16.ProvingKey, vk groth16.VerifyingKey) error {
 	return nil
 }
 
+// rateLimitKey returns the identity to rate-limit on: the caller identity
+// set by authMiddleware if present (the mTLS client certificate fingerprint,
+// or the JWT subject), otherwise the client IP.
+func rateLimitKey(c *gin.Context) string {
+	if identity, ok := c.Get(identityContextKey); ok {
+		return identity.(string)
+	}
+	return c.ClientIP()
+}
+
 func rateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
+		clientIP := rateLimitKey(c)
 
 		if !rateLimiter.Allow(clientIP) {
 			c.JSON(http.StatusTooManyRequests, gin.H{
@@ -311,8 +453,6 @@ func rateLimitMiddleware() gin.HandlerFunc {
 }
 
 func generateProofHandler(c *gin.Context) {
-	startTime := time.Now()
-
 	var req ProofRequest
 	if err := c.BindJSON(&req); err != nil {
 		log.Printf("Invalid request from %s: %v", c.ClientIP(), err)
@@ -332,19 +472,60 @@ func generateProofHandler(c *gin.Context) {
 	// Check cache first
 	if cached, found := proofCache.Get(&req); found {
 		log.Printf("âœ“ Proof served from cache for %s", c.ClientIP())
+		if proofJwt, err := signProofResponse(cached); err != nil {
+			log.Printf("Failed to sign proof envelope: %v", err)
+		} else {
+			cached.ProofJwt = proofJwt
+		}
 		c.JSON(http.StatusOK, cached)
 		return
 	}
 
+	if c.GetHeader("Prefer") == "respond-async" {
+		job := jobQueue.Enqueue(&req, c.Query("callbackUrl"))
+		c.JSON(http.StatusAccepted, gin.H{
+			"jobId":     job.ID,
+			"statusUrl": "/jobs/" + job.ID,
+		})
+		return
+	}
+
 	log.Printf("Generating proof for %s", c.ClientIP())
 
-	if err := preVerifySignature(&req); err != nil {
-		log.Printf("Signature verification failed: %v", err)
+	// GetOrGenerate coalesces concurrent requests for the same proof via
+	// singleflight, so N identical requests that all miss the cache only
+	// run the witness+prove pipeline once, and caches the result itself.
+	response, _, err := proofCache.GetOrGenerate(&req, func() (*ProofResponse, error) {
+		return generateProof(&req)
+	})
+	if err != nil {
+		log.Printf("Proof generation failed: %v", err)
 		proofGenerationErrors.Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid signature: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if proofJwt, err := signProofResponse(response); err != nil {
+		log.Printf("Failed to sign proof envelope: %v", err)
+	} else {
+		response.ProofJwt = proofJwt
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// generateProof runs the full Groth16 proving pipeline for req: signature
+// pre-verification, witness creation, proving, and a verification sanity
+// check on the resulting proof. It's the single code path shared by the
+// synchronous /generate-proof handler and the async job worker pool, so the
+// two can never drift.
+func generateProof(req *ProofRequest) (*ProofResponse, error) {
+	startTime := time.Now()
+
+	if err := preVerifySignature(req); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
 	// Create witness (assignment)
 	assignment := PaymentCircuit{
 		MinAmount:     req.MinAmount,
@@ -364,38 +545,26 @@ func generateProofHandler(c *gin.Context) {
 	// Create witness
 	witness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
 	if err != nil {
-		log.Printf("Witness creation failed: %v", err)
-		proofGenerationErrors.Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "witness creation failed"})
-		return
+		return nil, fmt.Errorf("witness creation failed: %w", err)
 	}
 
 	proofStart := time.Now()
 	proof, err := groth16.Prove(ccs, provingKey, witness)
 	if err != nil {
-		log.Printf("Proof generation failed: %v", err)
-		proofGenerationErrors.Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "proof generation failed"})
-		return
+		return nil, fmt.Errorf("proof generation failed: %w", err)
 	}
 	proofGenerationDuration.Observe(time.Since(proofStart).Seconds())
 
 	// Extract public witness
 	publicWitness, err := witness.Public()
 	if err != nil {
-		log.Printf("Public witness extraction failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "public witness extraction failed"})
-		return
+		return nil, fmt.Errorf("public witness extraction failed: %w", err)
 	}
 
 	// Verify proof (sanity check)
 	verifyStart := time.Now()
-	err = groth16.Verify(proof, verifyingKey, publicWitness)
-	if err != nil {
-		log.Printf("Proof verification failed: %v", err)
-		proofGenerationErrors.Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "generated proof is invalid"})
-		return
+	if err := groth16.Verify(proof, verifyingKey, publicWitness); err != nil {
+		return nil, fmt.Errorf("generated proof is invalid: %w", err)
 	}
 	proofVerificationDuration.Observe(time.Since(verifyStart).Seconds())
 
@@ -407,8 +576,7 @@ func generateProofHandler(c *gin.Context) {
 	// Serialize proof
 	proofBytes, err := json.Marshal(proof)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "proof serialization failed"})
-		return
+		return nil, fmt.Errorf("proof serialization failed: %w", err)
 	}
 
 	// Extract public inputs as strings
@@ -420,16 +588,11 @@ func generateProofHandler(c *gin.Context) {
 		fmt.Sprintf("%d", req.CurrentTime),
 	}
 
-	response := ProofResponse{
+	return &ProofResponse{
 		Proof:          string(proofBytes),
 		PublicInputs:   publicInputs,
 		GenerationTime: generationTime,
-	}
-
-	// Store in cache
-	proofCache.Set(&req, &response)
-
-	c.JSON(http.StatusOK, response)
+	}, nil
 }
 
 func preVerifySignature(req *ProofRequest) error {
@@ -488,6 +651,93 @@ func cacheStatsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+func listBackupChainsHandler(c *gin.Context) {
+	chains, err := backupManager.ListChains()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"chains": chains})
+}
+
+// restoreChainRequest is the body expected by POST /backup/restore.
+type restoreChainRequest struct {
+	ChainID    string `json:"chainId"`
+	At         string `json:"at"` // RFC3339 timestamp to restore as of
+	TargetPath string `json:"targetPath"`
+}
+
+func restoreBackupChainHandler(c *gin.Context) {
+	var req restoreChainRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format"})
+		return
+	}
+
+	targetTS, err := time.Parse(time.RFC3339, req.At)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid 'at' timestamp: %v", err)})
+		return
+	}
+
+	if err := backupManager.RestoreChainAt(req.ChainID, targetTS, req.TargetPath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "restored", "targetPath": req.TargetPath})
+}
+
+// runBackupCLI handles the "backup" subcommand family:
+//
+//	backup list-chains
+//	backup restore --chain <id> --at <RFC3339 timestamp> --out <path>
+func runBackupCLI(args []string) {
+	bm, err := NewBackupManagerFromEnv(24)
+	if err != nil {
+		log.Fatalf("Failed to initialize backup manager: %v", err)
+	}
+
+	if len(args) == 0 {
+		log.Fatal("Usage: prover backup <list-chains|restore> [flags]")
+	}
+
+	switch args[0] {
+	case "list-chains":
+		chains, err := bm.ListChains()
+		if err != nil {
+			log.Fatalf("Failed to list backup chains: %v", err)
+		}
+		for _, chain := range chains {
+			fmt.Printf("%s\t%d entries\tfullBackupEvery=%d\n", chain.ChainID, len(chain.Entries), chain.FullBackupEvery)
+		}
+
+	case "restore":
+		fs := flag.NewFlagSet("restore", flag.ExitOnError)
+		chainID := fs.String("chain", "", "chain ID to restore")
+		at := fs.String("at", "", "RFC3339 timestamp to restore as of")
+		out := fs.String("out", "", "path to write the restored database to")
+		fs.Parse(args[1:])
+
+		if *chainID == "" || *at == "" || *out == "" {
+			log.Fatal("Usage: prover backup restore --chain <id> --at <RFC3339 timestamp> --out <path>")
+		}
+
+		targetTS, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			log.Fatalf("Invalid --at timestamp: %v", err)
+		}
+
+		if err := bm.RestoreChainAt(*chainID, targetTS, *out); err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		fmt.Printf("Restored chain %q as of %s to %s\n", *chainID, *at, *out)
+
+	default:
+		log.Fatalf("Unknown backup subcommand %q", args[0])
+	}
+}
+
 func validateProofRequest(req *ProofRequest) error {
 	// Validate all required fields are present
 	if req.MinAmount == "" {
@@ -580,8 +830,10 @@ func isValidNumeric(s string) bool {
 
 func healthHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"status":  "healthy",
-		"service": "umbra-prover",
-		"version": "1.0.0",
+		"status":             "healthy",
+		"service":            "umbra-prover",
+		"version":            "1.0.0",
+		"provingKeySigner":   verifiedProvingKeySigner,
+		"verifyingKeySigner": verifiedVerifyingKeySigner,
 	})
 }
@@ -1,10 +1,10 @@
 package main
 
 import (
+	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/gin-gonic/gin"
 )
 
 var (
@@ -54,6 +54,76 @@ var (
 		Help:    "Time taken to generate witness",
 		Buckets: []float64{0.01, 0.02, 0.05, 0.1, 0.2, 0.5},
 	})
+
+	// Backup metrics
+	backupDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "backup_duration_seconds",
+		Help:    "Time taken to complete a database backup",
+		Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120},
+	})
+
+	backupPagesCopied = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backup_pages_copied",
+		Help: "Total number of SQLite pages copied by the online backup API",
+	})
+
+	backupFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "backup_failures_total",
+		Help: "Total number of failed database backup attempts",
+	})
+
+	// Proof cache metrics
+	proofCacheHitsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proof_cache_hits_total",
+		Help: "Total number of proof cache hits",
+	})
+
+	proofCacheMissesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proof_cache_misses_total",
+		Help: "Total number of proof cache misses",
+	})
+
+	proofCacheCoalescedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "proof_cache_coalesced_total",
+		Help: "Total number of proof requests that coalesced onto an in-flight generation instead of starting a new one",
+	})
+
+	diskCacheEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "disk_cache_evictions_total",
+		Help: "Total number of proofs evicted from the disk cache tier",
+	})
+
+	// Proof-of-work admission control metrics
+	powChallengesIssuedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pow_challenges_issued_total",
+		Help: "Total number of proof-of-work challenges issued",
+	})
+
+	powChallengesSolvedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "pow_challenges_solved_total",
+		Help: "Total number of proof-of-work challenges successfully solved",
+	})
+
+	powChallengesRejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pow_challenges_rejected_total",
+		Help: "Total number of proof-of-work challenges rejected, by reason",
+	}, []string{"reason"})
+
+	// Async job queue metrics
+	jobQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "job_queue_depth",
+		Help: "Number of async proof jobs waiting to be picked up by a worker",
+	})
+
+	jobWorkersActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "job_workers_active",
+		Help: "Number of worker goroutines currently processing an async proof job",
+	})
+
+	jobsByStatusTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_by_status_total",
+		Help: "Total number of async proof jobs that reached each status",
+	}, []string{"status"})
 )
 
 // metricsHandler returns a gin handler for Prometheus metrics
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"google.golang.org/api/iterator"
+)
+
+// BackupStore abstracts where backup blobs live, so BackupManager can write
+// to local disk, S3, or GCS without knowing which.
+type BackupStore interface {
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	List(ctx context.Context) ([]BackupInfo, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// parseStoreURL builds the BackupStore addressed by a URL such as
+// "s3://bucket/prefix", "gcs://bucket/prefix", or a plain local path, and
+// returns the blob name to use within that store.
+func parseStoreURL(storeURL string) (BackupStore, string, error) {
+	switch {
+	case strings.HasPrefix(storeURL, "s3://"):
+		rest := strings.TrimPrefix(storeURL, "s3://")
+		parts := strings.SplitN(rest, "/", 2)
+		if len(parts) != 2 {
+			return nil, "", fmt.Errorf("invalid s3 url %q, expected s3://bucket/key", storeURL)
+		}
+		store, err := NewS3Store(parts[0])
+		return store, parts[1], err
+	case strings.HasPrefix(storeURL, "gcs://"):
+		rest := strings.TrimPrefix(storeURL, "gcs://")
+		parts := strings.SplitN(rest, "/", 2)
+		if len(parts) != 2 {
+			return nil, "", fmt.Errorf("invalid gcs url %q, expected gcs://bucket/key", storeURL)
+		}
+		store, err := NewGCSStore(parts[0])
+		return store, parts[1], err
+	default:
+		return NewLocalStore(filepath.Dir(storeURL)), filepath.Base(storeURL), nil
+	}
+}
+
+// LocalStore stores backups as plain files on local disk.
+type LocalStore struct {
+	dir string
+}
+
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+func (s *LocalStore) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create local store directory: %w", err)
+	}
+
+	f, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to create local backup file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("failed to write local backup file: %w", err)
+	}
+
+	return f.Sync()
+}
+
+func (s *LocalStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, name))
+}
+
+func (s *LocalStore) List(ctx context.Context) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read local store directory: %w", err)
+	}
+
+	var backups []BackupInfo
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".db" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{
+			Name:      entry.Name(),
+			Path:      "local://" + filepath.Join(s.dir, entry.Name()),
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+		})
+	}
+	return backups, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+// S3Store stores backups in an S3-compatible bucket via minio-go.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store builds an S3Store from the S3_ENDPOINT/S3_ACCESS_KEY/
+// S3_SECRET_KEY/S3_USE_SSL environment variables.
+func NewS3Store(bucket string) (*S3Store, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	accessKey := os.Getenv("S3_ACCESS_KEY")
+	secretKey := os.Getenv("S3_SECRET_KEY")
+	useSSL := os.Getenv("S3_USE_SSL") != "false"
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	return &S3Store{client: client, bucket: bucket}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, name, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload backup to S3: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch backup from S3: %w", err)
+	}
+	return obj, nil
+}
+
+func (s *S3Store) List(ctx context.Context) ([]BackupInfo, error) {
+	var backups []BackupInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list S3 backups: %w", obj.Err)
+		}
+		if filepath.Ext(obj.Key) != ".db" {
+			continue
+		}
+		backups = append(backups, BackupInfo{
+			Name:      obj.Key,
+			Path:      fmt.Sprintf("s3://%s/%s", s.bucket, obj.Key),
+			Size:      obj.Size,
+			CreatedAt: obj.LastModified,
+		})
+	}
+	return backups, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, name string) error {
+	return s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{})
+}
+
+// GCSStore stores backups in a Google Cloud Storage bucket.
+type GCSStore struct {
+	client *storage.Client
+	bucket string
+}
+
+func NewGCSStore(bucket string) (*GCSStore, error) {
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	return &GCSStore{client: client, bucket: bucket}, nil
+}
+
+func (s *GCSStore) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	w := s.client.Bucket(s.bucket).Object(name).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to upload backup to GCS: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finalize GCS upload: %w", err)
+	}
+	return nil
+}
+
+func (s *GCSStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	r, err := s.client.Bucket(s.bucket).Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch backup from GCS: %w", err)
+	}
+	return r, nil
+}
+
+func (s *GCSStore) List(ctx context.Context) ([]BackupInfo, error) {
+	var backups []BackupInfo
+	it := s.client.Bucket(s.bucket).Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list GCS backups: %w", err)
+		}
+		if filepath.Ext(attrs.Name) != ".db" {
+			continue
+		}
+		backups = append(backups, BackupInfo{
+			Name:      attrs.Name,
+			Path:      fmt.Sprintf("gcs://%s/%s", s.bucket, attrs.Name),
+			Size:      attrs.Size,
+			CreatedAt: attrs.Created,
+		})
+	}
+	return backups, nil
+}
+
+func (s *GCSStore) Delete(ctx context.Context, name string) error {
+	return s.client.Bucket(s.bucket).Object(name).Delete(ctx)
+}
+
+// encryptingStore wraps a BackupStore with transparent gzip compression and
+// AES-GCM encryption, so backups at rest are unreadable without the key
+// loaded from BACKUP_ENCRYPTION_KEY (base64-encoded 32-byte key, typically
+// sourced from a KMS-backed secret in production).
+type encryptingStore struct {
+	inner BackupStore
+	key   []byte
+}
+
+// newEncryptingStore wraps store with AES-GCM encryption if
+// BACKUP_ENCRYPTION_KEY is set, otherwise returns store unwrapped.
+func newEncryptingStore(store BackupStore) (BackupStore, error) {
+	keyB64 := os.Getenv("BACKUP_ENCRYPTION_KEY")
+	if keyB64 == "" {
+		log.Warn("BACKUP_ENCRYPTION_KEY not set - backups will be stored unencrypted")
+		return store, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode BACKUP_ENCRYPTION_KEY: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("BACKUP_ENCRYPTION_KEY must decode to 32 bytes, got %d", len(key))
+	}
+
+	return &encryptingStore{inner: store, key: key}, nil
+}
+
+func (s *encryptingStore) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	if _, err := io.Copy(gw, r); err != nil {
+		return fmt.Errorf("failed to compress backup: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("failed to flush gzip stream: %w", err)
+	}
+
+	sealed, err := s.seal(compressed.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+
+	return s.inner.Put(ctx, name, bytes.NewReader(sealed), int64(len(sealed)))
+}
+
+func (s *encryptingStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := s.inner.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	sealed, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encrypted backup: %w", err)
+	}
+
+	compressed, err := s.open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+
+	return gr, nil
+}
+
+func (s *encryptingStore) List(ctx context.Context) ([]BackupInfo, error) {
+	return s.inner.List(ctx)
+}
+
+func (s *encryptingStore) Delete(ctx context.Context, name string) error {
+	return s.inner.Delete(ctx, name)
+}
+
+func (s *encryptingStore) seal(plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (s *encryptingStore) open(sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:nonceSize], sealed[nonceSize:]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}